@@ -1,46 +1,164 @@
 package cgroups
 
 import (
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"path"
 	"runQ/cgroups/fs"
+	"runQ/cgroups/fs2"
 	"runQ/cgroups/resource"
 )
 
+// DefaultParent 容器 cgroup 的默认父路径，每个容器使用 runQ/{containerId} 作为自己的 cgroup
+const DefaultParent = "runQ"
+
 type CgroupManager struct {
-	Path     string
-	Resource *resource.ResourceConfig
+	Path       string
+	Resource   *resource.ResourceConfig
+	subsystems []resource.Subsystem
 }
 
+// NewCgroupManager 根据宿主机的 cgroup 版本选择 fs(v1) 或 fs2(v2) 的 subsystem 实现
 func NewCgroupManager(path string) *CgroupManager {
-	return &CgroupManager{Path: path}
+	subsystems := fs.SubsystemIns
+	if IsCgroup2UnifiedMode() {
+		subsystems = fs2.SubsystemIns
+	}
+	return &CgroupManager{Path: path, subsystems: subsystems}
+}
+
+// ContainerCgroupPath 拼接容器的 cgroup 路径，e.g. runQ/1234567890
+func ContainerCgroupPath(parent, containerId string) string {
+	if parent == "" {
+		parent = DefaultParent
+	}
+	return path.Join(parent, containerId)
+}
+
+// RootlessParent rootless 模式下容器 cgroup 的父路径，位于 systemd 委派给当前用户的 cgroup v2 子树中
+// cgroup v1 不支持委派，没有可写的子树时返回错误，调用方应跳过资源限制
+func RootlessParent(parent string) (string, error) {
+	if !IsCgroup2UnifiedMode() {
+		return "", errors.New("cgroup v1 can not be delegated to unprivileged users")
+	}
+	root, err := fs2.DelegatedRoot()
+	if err != nil {
+		return "", err
+	}
+	if parent == "" {
+		parent = DefaultParent
+	}
+	return path.Join(root, parent), nil
 }
 
+// Apply 将进程加入各个 subsystem 的 cgroup，任意一个失败时返回错误，进程可能只受部分限制
+// rootless 模式下没有委派给当前用户的 controller 只打印警告并跳过
 func (c *CgroupManager) Apply(pid int, config *resource.ResourceConfig) error {
-	for _, subSysIns := range fs.SubsystemIns {
-		err := subSysIns.Apply(c.Path, pid, config)
-		if err != nil {
-			log.Errorf("apply subsystem: %s err: %s", subSysIns.Name(), err)
+	for _, subSysIns := range c.subsystems {
+		if err := subSysIns.Apply(c.Path, pid, config); err != nil {
+			if errors.Is(err, fs2.ErrControllerNotDelegated) {
+				log.Warnf("skip subsystem %s: %v", subSysIns.Name(), err)
+				continue
+			}
+			return errors.WithMessagef(err, "apply subsystem %s", subSysIns.Name())
 		}
-
 	}
 	return nil
 }
 
+// Set 将资源限制写入各个 subsystem，遇到内核拒绝的写入时立即返回错误
 func (c *CgroupManager) Set(config *resource.ResourceConfig) error {
-	for _, subSysIns := range fs.SubsystemIns {
-		err := subSysIns.Set(c.Path, config)
-		if err != nil {
-			log.Errorf("apply subsystem: %s err:%s", subSysIns.Name(), err)
+	for _, subSysIns := range c.subsystems {
+		if err := subSysIns.Set(c.Path, config); err != nil {
+			if errors.Is(err, fs2.ErrControllerNotDelegated) {
+				log.Warnf("skip subsystem %s: %v", subSysIns.Name(), err)
+				continue
+			}
+			return errors.WithMessagef(err, "set subsystem %s", subSysIns.Name())
 		}
 	}
+	c.Resource = config
 	return nil
 }
 
+// Update 修改运行中容器的资源限制
+// v1 中部分 subsystem 只有在设置了限制时才会加入进程，新增限制后需要把容器中已有的进程重新加入 cgroup
+func (c *CgroupManager) Update(config *resource.ResourceConfig) error {
+	if err := c.Set(config); err != nil {
+		return err
+	}
+	pids, err := c.GetPids()
+	if err != nil {
+		return errors.WithMessage(err, "get cgroup pids")
+	}
+	for _, pid := range pids {
+		_ = c.Apply(pid, config)
+	}
+	return nil
+}
+
+// ProcsFiles 容器 init 进程 pid 所在的 cgroup.procs 文件，exec 的进程写入这些文件后与容器受同样的资源限制
+func (c *CgroupManager) ProcsFiles(pid int) []string {
+	if IsCgroup2UnifiedMode() {
+		return []string{fs2.ProcsFile(c.Path)}
+	}
+	return fs.ProcsFiles(c.Path, pid)
+}
+
+// GetPids 获取容器 cgroup 中的所有进程
+func (c *CgroupManager) GetPids() ([]int, error) {
+	if IsCgroup2UnifiedMode() {
+		return fs2.GetPids(c.Path)
+	}
+	return fs.GetPids(c.Path)
+}
+
 func (c *CgroupManager) Destroy() error {
-	for _, subSysIns := range fs.SubsystemIns {
+	for _, subSysIns := range c.subsystems {
 		if err := subSysIns.Remove(c.Path); err != nil {
 			log.Warnf("remove cgroup fail %v", err)
 		}
 	}
 	return nil
 }
+
+// GetStats 从容器的 cgroup 中读取各个 subsystem 的资源使用情况
+func (c *CgroupManager) GetStats() (*resource.Stats, error) {
+	stats := &resource.Stats{}
+	for _, subSysIns := range c.subsystems {
+		getter, ok := subSysIns.(resource.StatsGetter)
+		if !ok {
+			continue
+		}
+		if err := getter.GetStats(c.Path, stats); err != nil {
+			return stats, errors.Wrapf(err, "get %s stats", subSysIns.Name())
+		}
+	}
+	return stats, nil
+}
+
+// NotifyOOM 监听容器 cgroup 的 OOM 事件，cgroup 被删除后返回的 channel 会被关闭
+func (c *CgroupManager) NotifyOOM() (<-chan struct{}, error) {
+	if IsCgroup2UnifiedMode() {
+		return fs2.NotifyOOM(c.Path)
+	}
+	return fs.NotifyOOM(c.Path)
+}
+
+// OOMKillCount 获取容器内被 OOM killer 杀死的进程数
+func (c *CgroupManager) OOMKillCount() (uint64, error) {
+	if IsCgroup2UnifiedMode() {
+		return fs2.OOMKillCount(c.Path)
+	}
+	return fs.OOMKillCount(c.Path)
+}
+
+// Freeze 冻结或解冻容器中的所有进程，返回时冻结已经完成
+func (c *CgroupManager) Freeze(state resource.FreezerState) error {
+	for _, subSysIns := range c.subsystems {
+		if freezer, ok := subSysIns.(resource.Freezer); ok {
+			return freezer.Freeze(c.Path, state)
+		}
+	}
+	return errors.New("freezer is not supported")
+}
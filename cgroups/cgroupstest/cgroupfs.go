@@ -0,0 +1,231 @@
+// Package cgroupstest 提供一个伪造的 cgroupfs，用临时目录模拟 v1 的各个 subsystem 挂载点和 v2 的统一层级，
+// 使 cgroups 下的 subsystem 不需要 root 权限也能测试
+package cgroupstest
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// v1Files 内核在 v1 中新建 cgroup 目录时自动生成的接口文件及其默认值，根 cgroup 的值见 v1RootFiles
+// 新建的 cpuset cgroup 中 cpuset.cpus 和 cpuset.mems 为空，需要 runQ 从父 cgroup 继承
+var v1Files = map[string]map[string]string{
+	"cpuset": {
+		"cpuset.cpus":           "",
+		"cpuset.mems":           "",
+		"cpuset.effective_cpus": "0-3",
+		"cpuset.effective_mems": "0",
+	},
+	"memory": {
+		"memory.limit_in_bytes":          "9223372036854771712",
+		"memory.memsw.limit_in_bytes":    "9223372036854771712",
+		"memory.soft_limit_in_bytes":     "9223372036854771712",
+		"memory.kmem.limit_in_bytes":     "9223372036854771712",
+		"memory.kmem.tcp.limit_in_bytes": "9223372036854771712",
+		"memory.swappiness":              "60",
+		"memory.oom_control":             "oom_kill_disable 0\nunder_oom 0\noom_kill 0\n",
+		"memory.usage_in_bytes":          "0",
+		"memory.stat":                    "total_inactive_file 0\n",
+		"cgroup.event_control":           "",
+	},
+	"cpu": {
+		"cpu.shares":        "1024",
+		"cpu.cfs_period_us": "100000",
+		"cpu.cfs_quota_us":  "-1",
+	},
+	"cpuacct": {
+		"cpuacct.usage": "0",
+	},
+	"pids": {
+		"pids.max":     "max",
+		"pids.current": "0",
+	},
+	"blkio": {
+		"blkio.weight":                     "500",
+		"blkio.weight_device":              "",
+		"blkio.throttle.read_bps_device":   "",
+		"blkio.throttle.write_bps_device":  "",
+		"blkio.throttle.read_iops_device":  "",
+		"blkio.throttle.write_iops_device": "",
+		"blkio.throttle.io_service_bytes":  "Total 0\n",
+	},
+	"devices": {
+		"devices.allow": "",
+		"devices.deny":  "",
+		"devices.list":  "a *:* rwm\n",
+	},
+	"hugetlb": {
+		"hugetlb.2MB.limit_in_bytes": "9223372036854771712",
+		"hugetlb.1GB.limit_in_bytes": "9223372036854771712",
+	},
+	"freezer": {
+		"freezer.state": "THAWED",
+	},
+}
+
+var v1RootFiles = map[string]map[string]string{
+	"cpuset": {
+		"cpuset.cpus":           "0-3",
+		"cpuset.mems":           "0",
+		"cpuset.effective_cpus": "0-3",
+		"cpuset.effective_mems": "0",
+	},
+}
+
+// v2Controllers 伪造的 v2 根 cgroup 中可用的 controller
+const v2Controllers = "cpuset cpu io memory hugetlb pids"
+
+// v2Files 内核在 v2 中新建 cgroup 目录时自动生成的接口文件及其默认值
+var v2Files = map[string]string{
+	"cgroup.controllers":     v2Controllers,
+	"cgroup.subtree_control": "",
+	"cgroup.procs":           "",
+	"cgroup.events":          "populated 0\nfrozen 0\n",
+	"cgroup.freeze":          "0",
+	"cpu.weight":             "100",
+	"cpu.max":                "max 100000",
+	"cpu.stat":               "usage_usec 0\nuser_usec 0\nsystem_usec 0\n",
+	"cpuset.cpus":            "",
+	"cpuset.mems":            "",
+	"cpuset.cpus.effective":  "0-3",
+	"cpuset.mems.effective":  "0",
+	"memory.max":             "max",
+	"memory.swap.max":        "max",
+	"memory.low":             "0",
+	"memory.current":         "0",
+	"memory.stat":            "inactive_file 0\n",
+	"memory.events":          "low 0\nhigh 0\nmax 0\noom 0\noom_kill 0\n",
+	"pids.max":               "max",
+	"pids.current":           "0",
+	"io.weight":              "default 100",
+	"io.max":                 "",
+	"io.stat":                "",
+	"hugetlb.2MB.max":        "max",
+	"hugetlb.1GB.max":        "max",
+}
+
+// FakeCgroupfs 伪造的 cgroupfs，Root 为临时目录
+// 普通目录无法像内核一样在 mkdir 时自动生成接口文件，所以需要先调用 Create 创建 cgroup
+type FakeCgroupfs struct {
+	Root      string
+	MountInfo string // v1 中伪造的 mountinfo 文件，其中记录了每个 subsystem 在 Root 下的挂载点
+	unified   bool
+	t         testing.TB
+}
+
+// NewV1 创建一个伪造的 v1 cgroupfs，每个 subsystem 挂载在 Root/{subsystem}
+func NewV1(t testing.TB) *FakeCgroupfs {
+	t.Helper()
+	f := &FakeCgroupfs{Root: t.TempDir(), t: t}
+	var mountInfo strings.Builder
+	id := 30
+	for subsystem := range v1Files {
+		mountpoint := path.Join(f.Root, subsystem)
+		f.writeFiles(mountpoint, v1Files[subsystem])
+		f.writeFiles(mountpoint, v1RootFiles[subsystem])
+		// 格式与 /proc/self/mountinfo 相同，e.g. 30 25 0:26 / /sys/fs/cgroup/memory rw,nosuid - cgroup cgroup rw,memory
+		_, _ = fmt.Fprintf(&mountInfo, "%d 25 0:%d / %s rw,nosuid,nodev,noexec,relatime - cgroup cgroup rw,%s\n",
+			id, id, mountpoint, subsystem)
+		id++
+	}
+	f.MountInfo = path.Join(f.Root, "mountinfo")
+	f.writeFile(f.MountInfo, mountInfo.String())
+	return f
+}
+
+// NewV2 创建一个伪造的 v2 统一层级，Root 即为挂载点
+func NewV2(t testing.TB) *FakeCgroupfs {
+	t.Helper()
+	f := &FakeCgroupfs{Root: t.TempDir(), unified: true, t: t}
+	f.writeFiles(f.Root, map[string]string{
+		"cgroup.controllers":     v2Controllers,
+		"cgroup.subtree_control": "",
+		"cgroup.procs":           "",
+		"cpuset.cpus.effective":  "0-3",
+		"cpuset.mems.effective":  "0",
+	})
+	return f
+}
+
+// Create 模拟内核逐级创建 cgroup 目录并生成接口文件
+func (f *FakeCgroupfs) Create(cgroupPath string) {
+	f.t.Helper()
+	elems := strings.Split(strings.Trim(path.Clean(cgroupPath), "/"), "/")
+	for i := range elems {
+		current := path.Join(elems[:i+1]...)
+		if f.unified {
+			f.create(path.Join(f.Root, current), v2Files)
+			continue
+		}
+		for subsystem, files := range v1Files {
+			f.create(path.Join(f.Root, subsystem, current), files)
+		}
+	}
+}
+
+// create 已经存在的目录不再覆盖其中的文件
+func (f *FakeCgroupfs) create(dir string, files map[string]string) {
+	if _, err := os.Stat(dir); err == nil {
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		f.t.Fatal(err)
+	}
+	f.writeFiles(dir, files)
+}
+
+func (f *FakeCgroupfs) writeFiles(dir string, files map[string]string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		f.t.Fatal(err)
+	}
+	for file, content := range files {
+		f.writeFile(path.Join(dir, file), content)
+	}
+	// v1 中每个 cgroup 都有 tasks 和 cgroup.procs
+	if !f.unified {
+		for _, file := range []string{"tasks", "cgroup.procs"} {
+			if _, ok := files[file]; !ok {
+				f.writeFile(path.Join(dir, file), "")
+			}
+		}
+	}
+}
+
+func (f *FakeCgroupfs) writeFile(file, content string) {
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// Path 获取 cgroup 的绝对路径，v2 中忽略 subsystem
+func (f *FakeCgroupfs) Path(subsystem, cgroupPath string) string {
+	if f.unified {
+		return path.Join(f.Root, cgroupPath)
+	}
+	return path.Join(f.Root, subsystem, cgroupPath)
+}
+
+// ReadFile 读取 cgroup 接口文件的内容，去掉首尾空白
+func (f *FakeCgroupfs) ReadFile(subsystem, cgroupPath, file string) string {
+	f.t.Helper()
+	content, err := os.ReadFile(path.Join(f.Path(subsystem, cgroupPath), file))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// WriteFile 修改 cgroup 接口文件的内容，用于模拟内核更新统计信息
+func (f *FakeCgroupfs) WriteFile(subsystem, cgroupPath, file, content string) {
+	f.t.Helper()
+	f.writeFile(path.Join(f.Path(subsystem, cgroupPath), file), content)
+}
+
+// Exists cgroup 目录是否存在
+func (f *FakeCgroupfs) Exists(subsystem, cgroupPath string) bool {
+	_, err := os.Stat(f.Path(subsystem, cgroupPath))
+	return err == nil
+}
@@ -0,0 +1,119 @@
+package fs
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+	"strconv"
+	"strings"
+)
+
+type BlkioSubsystem struct {
+}
+
+func (s *BlkioSubsystem) Name() string {
+	return "blkio"
+}
+
+func (s *BlkioSubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
+	if !res.HasBlkioLimit() {
+		return nil
+	}
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	// 使用 BFQ 调度器的内核没有 blkio.weight，对应的是 blkio.bfq.weight
+	weightFile, weightDeviceFile := "blkio.weight", "blkio.weight_device"
+	if _, err = os.Stat(path.Join(subsysCgroupPath, weightFile)); os.IsNotExist(err) {
+		weightFile, weightDeviceFile = "blkio.bfq.weight", "blkio.bfq.weight_device"
+	}
+	if res.BlkioWeight != 0 {
+		if err = os.WriteFile(path.Join(subsysCgroupPath, weightFile), []byte(strconv.Itoa(int(res.BlkioWeight))), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup blkio weight fail %v", err)
+		}
+	}
+	for _, wd := range res.BlkioWeightDevice {
+		if err = os.WriteFile(path.Join(subsysCgroupPath, weightDeviceFile), []byte(wd.String()), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup blkio weight device fail %v", err)
+		}
+	}
+	// throttle 文件每次只能写入一个设备的限制，e.g. echo "8:0 10485760" > blkio.throttle.read_bps_device
+	throttles := map[string][]*resource.ThrottleDevice{
+		"blkio.throttle.read_bps_device":   res.BlkioThrottleReadBpsDevice,
+		"blkio.throttle.write_bps_device":  res.BlkioThrottleWriteBpsDevice,
+		"blkio.throttle.read_iops_device":  res.BlkioThrottleReadIOPSDevice,
+		"blkio.throttle.write_iops_device": res.BlkioThrottleWriteIOPSDevice,
+	}
+	for file, devices := range throttles {
+		for _, td := range devices {
+			if err = os.WriteFile(path.Join(subsysCgroupPath, file), []byte(td.String()), constant.Perm0644); err != nil {
+				return fmt.Errorf("set cgroup %s fail %v", file, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply 即使没有设置 IO 限制也将进程加入 blkio cgroup，用于统计容器的块设备读写
+func (s *BlkioSubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+	return applyPid(subsysCgroupPath, pid)
+}
+
+func (s *BlkioSubsystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsysCgroupPath)
+}
+
+// GetStats 读取 blkio.throttle.io_service_bytes，格式为每行 "8:0 Read 4096"
+func (s *BlkioSubsystem) GetStats(cgroupPath string, stats *resource.Stats) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(path.Join(subsysCgroupPath, "blkio.throttle.io_service_bytes"))
+	if err != nil {
+		return err
+	}
+	devices := map[string]*resource.BlkioDeviceStats{}
+	var order []string
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		device, ok := devices[fields[0]]
+		if !ok {
+			device = &resource.BlkioDeviceStats{}
+			if _, err = fmt.Sscanf(fields[0], "%d:%d", &device.Major, &device.Minor); err != nil {
+				continue
+			}
+			devices[fields[0]] = device
+			order = append(order, fields[0])
+		}
+		value, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "parse blkio.throttle.io_service_bytes")
+		}
+		switch fields[1] {
+		case "Read":
+			device.ReadBytes = value
+		case "Write":
+			device.WriteBytes = value
+		}
+	}
+	for _, key := range order {
+		stats.Blkio.Add(devices[key])
+	}
+	return nil
+}
@@ -12,54 +12,47 @@ import (
 type CpuSubsystem struct {
 }
 
-const (
-	PeriodDefault = 100000
-	Percent       = 100
-)
-
 func (s *CpuSubsystem) Name() string {
 	return "cpu"
 }
 
 func (s *CpuSubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
 
-	if res.CpuCfsQuota == 0 && res.CpuShare == "" {
+	if !res.HasCpuLimit() {
 		return nil
 	}
 	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
 	if err != nil {
 		return err
 	}
-	if res.CpuShare != "" {
-		if err = os.WriteFile(path.Join(subsysCgroupPath, "cpu.shares"), []byte(res.CpuShare), constant.Perm0644); err != nil {
+	if res.CpuShares != 0 {
+		if err = os.WriteFile(path.Join(subsysCgroupPath, "cpu.shares"), []byte(strconv.FormatUint(res.CpuShares, 10)), constant.Perm0644); err != nil {
 			return fmt.Errorf("set cgroup cpu share fail %v", err)
 		}
 	}
-
-	if res.CpuCfsQuota != 0 {
-		if err = os.WriteFile(path.Join(subsysCgroupPath, "cpu.cfs_period_us"), []byte(strconv.Itoa(PeriodDefault)), constant.Perm0644); err != nil {
-			return fmt.Errorf("set cgroup cpu share fail %v", err)
+	// 先写 period 再写 quota，内核会根据 period 检查 quota 是否合法
+	if res.CpuPeriod != 0 {
+		if err = os.WriteFile(path.Join(subsysCgroupPath, "cpu.cfs_period_us"), []byte(strconv.FormatUint(res.CpuPeriod, 10)), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup cpu period fail %v", err)
 		}
-
-		if err = os.WriteFile(path.Join(subsysCgroupPath, "cpu.cfs_period_us"), []byte(strconv.Itoa(PeriodDefault/Percent*res.CpuCfsQuota)), constant.Perm0644); err != nil {
-			return fmt.Errorf("set cgroup cpu share fail %v", err)
+	}
+	if res.CpuQuota != 0 {
+		if err = os.WriteFile(path.Join(subsysCgroupPath, "cpu.cfs_quota_us"), []byte(strconv.FormatInt(res.CpuQuota, 10)), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup cpu quota fail %v", err)
 		}
 	}
 	return nil
 }
 
 func (s *CpuSubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
-	if res.CpuCfsQuota == 0 && res.CpuShare == "" {
+	if !res.HasCpuLimit() {
 		return nil
 	}
 	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
 	if err != nil {
 		return fmt.Errorf("get cgroup %s error: %v", cgroupPath, err)
 	}
-	if err = os.WriteFile(path.Join(subsysCgroupPath, "tasks"), []byte(strconv.Itoa(pid)), constant.Perm0644); err != nil {
-		return fmt.Errorf("set cgroup proc fail %v", err)
-	}
-	return nil
+	return applyPid(subsysCgroupPath, pid)
 }
 
 func (s *CpuSubsystem) Remove(cgroupPath string) error {
@@ -0,0 +1,44 @@
+package fs
+
+import (
+	"github.com/pkg/errors"
+	"os"
+	"runQ/cgroups/resource"
+)
+
+// CpuacctSubsystem 不做任何限制，只用于统计容器的 CPU 使用时间
+type CpuacctSubsystem struct {
+}
+
+func (s *CpuacctSubsystem) Name() string {
+	return "cpuacct"
+}
+
+func (s *CpuacctSubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
+	return nil
+}
+
+func (s *CpuacctSubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+	return applyPid(subsysCgroupPath, pid)
+}
+
+func (s *CpuacctSubsystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsysCgroupPath)
+}
+
+func (s *CpuacctSubsystem) GetStats(cgroupPath string, stats *resource.Stats) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	stats.Cpu.UsageTotal, err = getCgroupParamUint(subsysCgroupPath, "cpuacct.usage")
+	return err
+}
@@ -7,43 +7,52 @@ import (
 	"path"
 	"runQ/cgroups/resource"
 	"runQ/constant"
-	"strconv"
+	"strings"
 )
 
 type CpusetSubsystem struct {
 }
 
 func (s *CpusetSubsystem) Name() string {
-	return "cpu"
+	return "cpuset"
 }
 
 func (s *CpusetSubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
 
-	if res.CpuSet == "" {
+	if !res.HasCpusetLimit() {
 		return nil
 	}
-	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	subsysCgroupPath, err := s.ensureCgroup(cgroupPath)
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(path.Join(subsysCgroupPath, "cpuset.cpus"), []byte(res.CpuSet), constant.Perm0644); err != nil {
-		return fmt.Errorf("set cgroup cpuset fail %v", err)
+	parent := path.Dir(subsysCgroupPath)
+	if res.CpuSet != "" {
+		if err = checkEffective(parent, "cpus", res.CpuSet); err != nil {
+			return err
+		}
+		if err = os.WriteFile(path.Join(subsysCgroupPath, "cpuset.cpus"), []byte(res.CpuSet), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup cpuset fail %v", err)
+		}
+	}
+	if res.CpusetMems != "" {
+		if err = checkEffective(parent, "mems", res.CpusetMems); err != nil {
+			return err
+		}
+		if err = os.WriteFile(path.Join(subsysCgroupPath, "cpuset.mems"), []byte(res.CpusetMems), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup cpuset mems fail %v", err)
+		}
 	}
 	return nil
 }
 
+// Apply 即使没有设置 cpuset 限制也将进程加入 cpuset cgroup，用于查看容器实际可用的 CPU 和内存节点
 func (s *CpusetSubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
-	if res.CpuSet == "" {
-		return nil
-	}
-	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	subsysCgroupPath, err := s.ensureCgroup(cgroupPath)
 	if err != nil {
 		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
 	}
-	if err = os.WriteFile(path.Join(subsysCgroupPath, "tasks"), []byte(strconv.Itoa(pid)), constant.Perm0644); err != nil {
-		return fmt.Errorf("set cgroup proc fail %v", err)
-	}
-	return nil
+	return applyPid(subsysCgroupPath, pid)
 }
 
 func (s *CpusetSubsystem) Remove(cgroupPath string) error {
@@ -53,3 +62,81 @@ func (s *CpusetSubsystem) Remove(cgroupPath string) error {
 	}
 	return os.RemoveAll(subsysCgroupPath)
 }
+
+func (s *CpusetSubsystem) GetStats(cgroupPath string, stats *resource.Stats) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	if stats.Cpuset.EffectiveCpus, err = readEffective(subsysCgroupPath, "cpus"); err != nil {
+		return err
+	}
+	stats.Cpuset.EffectiveMems, err = readEffective(subsysCgroupPath, "mems")
+	return err
+}
+
+// ensureCgroup 逐级创建 cpuset cgroup
+// v1 中新建的 cpuset cgroup 的 cpuset.cpus 和 cpuset.mems 都是空的，此时内核会拒绝加入任何进程，
+// 所以每一级都需要先从父 cgroup 继承这两个值
+func (s *CpusetSubsystem) ensureCgroup(cgroupPath string) (string, error) {
+	current := findCgroupMountpoint(s.Name())
+	if current == "" {
+		return "", fmt.Errorf("cgroup subsystem %s is not mounted", s.Name())
+	}
+	for _, elem := range strings.Split(strings.Trim(path.Clean(cgroupPath), "/"), "/") {
+		if elem == "" {
+			continue
+		}
+		parent := current
+		current = path.Join(current, elem)
+		if err := os.Mkdir(current, constant.Perm0755); err != nil && !os.IsExist(err) {
+			return "", errors.Wrap(err, "create cgroup")
+		}
+		for _, file := range []string{"cpuset.cpus", "cpuset.mems"} {
+			if err := inheritCpuset(parent, current, file); err != nil {
+				return "", err
+			}
+		}
+	}
+	return current, nil
+}
+
+// inheritCpuset 如果子 cgroup 的 file 为空，则写入父 cgroup 的值
+func inheritCpuset(parent, current, file string) error {
+	content, err := os.ReadFile(path.Join(current, file))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(content)) != "" {
+		return nil
+	}
+	parentContent, err := os.ReadFile(path.Join(parent, file))
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(path.Join(current, file), parentContent, constant.Perm0644); err != nil {
+		return errors.Wrapf(err, "inherit %s from %s", file, parent)
+	}
+	return nil
+}
+
+// readEffective 读取实际生效的 cpus/mems，老版本内核没有 cpuset.effective_* 文件时使用 cpuset.*
+func readEffective(cgroupPath, kind string) (string, error) {
+	content, err := os.ReadFile(path.Join(cgroupPath, "cpuset.effective_"+kind))
+	if os.IsNotExist(err) {
+		content, err = os.ReadFile(path.Join(cgroupPath, "cpuset."+kind))
+	}
+	return strings.TrimSpace(string(content)), err
+}
+
+// checkEffective 检查请求的 cpus/mems 是否在父 cgroup 实际可用的范围内
+func checkEffective(parent, kind, list string) error {
+	available, err := readEffective(parent, kind)
+	if err != nil {
+		return err
+	}
+	if err = resource.CheckCpuListSubset(list, available); err != nil {
+		return errors.WithMessagef(err, "invalid cpuset %s", kind)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package fs
+
+import (
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+)
+
+type DevicesSubsystem struct {
+}
+
+func (s *DevicesSubsystem) Name() string {
+	return "devices"
+}
+
+// Set 先禁止访问所有设备，再逐条写入允许的设备，相当于白名单
+func (s *DevicesSubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
+	if len(res.Devices) == 0 {
+		return nil
+	}
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(path.Join(subsysCgroupPath, "devices.deny"), []byte("a"), constant.Perm0644); err != nil {
+		return errors.Wrap(err, "set cgroup devices.deny")
+	}
+	for _, rule := range res.Devices {
+		file := "devices.deny"
+		if rule.Allow {
+			file = "devices.allow"
+		}
+		// 每次只能写入一条规则
+		if err = os.WriteFile(path.Join(subsysCgroupPath, file), []byte(rule.String()), constant.Perm0644); err != nil {
+			return errors.Wrapf(err, "set cgroup %s %s", file, rule)
+		}
+	}
+	return nil
+}
+
+func (s *DevicesSubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
+	if len(res.Devices) == 0 {
+		return nil
+	}
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+	return applyPid(subsysCgroupPath, pid)
+}
+
+func (s *DevicesSubsystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsysCgroupPath)
+}
@@ -0,0 +1,80 @@
+package fs
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+	"strings"
+	"time"
+)
+
+const (
+	freezerStateFile = "freezer.state"
+	// freezeTimeout 等待冻结完成的最长时间，进程处于不可中断睡眠时可能一直无法冻结
+	freezeTimeout       = 10 * time.Second
+	freezeCheckInterval = 10 * time.Millisecond
+)
+
+// FreezerSubsystem 不做资源限制，用于 pause/unpause 时冻结容器中的所有进程
+type FreezerSubsystem struct {
+}
+
+func (s *FreezerSubsystem) Name() string {
+	return "freezer"
+}
+
+func (s *FreezerSubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
+	return nil
+}
+
+// Apply 进程需要事先加入 freezer cgroup，之后才能随时暂停容器
+func (s *FreezerSubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+	return applyPid(subsysCgroupPath, pid)
+}
+
+func (s *FreezerSubsystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsysCgroupPath)
+}
+
+// Freeze 写入 freezer.state 后内核会逐个冻结进程，期间读到的状态为 FREEZING，需要等到变为 FROZEN 才算完成
+func (s *FreezerSubsystem) Freeze(cgroupPath string, state resource.FreezerState) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	stateFile := path.Join(subsysCgroupPath, freezerStateFile)
+	deadline := time.Now().Add(freezeTimeout)
+	for {
+		// FREEZING 期间有新进程 fork 出来时可能需要重新写入
+		if err = os.WriteFile(stateFile, []byte(state), constant.Perm0644); err != nil {
+			return errors.Wrapf(err, "set cgroup %s", freezerStateFile)
+		}
+		content, err := os.ReadFile(stateFile)
+		if err != nil {
+			return err
+		}
+		current := strings.TrimSpace(string(content))
+		if current == string(state) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			// 冻结失败时恢复运行，避免容器停留在 FREEZING 状态
+			if state == resource.Frozen {
+				_ = os.WriteFile(stateFile, []byte(resource.Thawed), constant.Perm0644)
+			}
+			return fmt.Errorf("timeout waiting for freezer state %s, current state %s", state, current)
+		}
+		time.Sleep(freezeCheckInterval)
+	}
+}
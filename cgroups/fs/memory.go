@@ -6,20 +6,23 @@ import (
 	"os"
 	"path"
 	"runQ/cgroups/resource"
-	"runQ/constant"
-	"strconv"
 )
 
 type MemorySubsystem struct {
 }
 
+const (
+	memoryLimitFile     = "memory.limit_in_bytes"
+	memorySwapLimitFile = "memory.memsw.limit_in_bytes"
+)
+
 func (s *MemorySubsystem) Name() string {
 	return "memory"
 }
 
 func (s *MemorySubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
 
-	if res.MemoryLimit == "" {
+	if !res.HasMemoryLimit() {
 		return nil
 	}
 
@@ -27,12 +30,72 @@ func (s *MemorySubsystem) Set(cgroupPath string, res *resource.ResourceConfig) e
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(path.Join(subsystemCgroupPath, "memory.limit_in_bytes"), []byte(res.MemoryLimit), constant.Perm0644); err != nil {
-		return fmt.Errorf("set cgroup memory fail %v", err)
+	if err = setMemoryAndSwap(subsystemCgroupPath, res); err != nil {
+		return err
+	}
+	files := []struct {
+		name  string
+		value int64
+	}{
+		{"memory.soft_limit_in_bytes", res.MemoryReservation},
+		{"memory.kmem.limit_in_bytes", res.KernelMemory},
+		{"memory.kmem.tcp.limit_in_bytes", res.KernelMemoryTCP},
+	}
+	for _, file := range files {
+		if file.value == 0 {
+			continue
+		}
+		if err = writeInt(subsystemCgroupPath, file.name, file.value); err != nil {
+			return err
+		}
+	}
+	if res.MemorySwappiness != nil {
+		if err = writeInt(subsystemCgroupPath, "memory.swappiness", int64(*res.MemorySwappiness)); err != nil {
+			return err
+		}
+	}
+	if res.OomKillDisable {
+		if err = writeInt(subsystemCgroupPath, "memory.oom_control", 1); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// setMemoryAndSwap 设置内存和 memsw(内存+swap) 上限
+// 内核要求 memory.limit_in_bytes 始终不大于 memory.memsw.limit_in_bytes，
+// 所以调大限制时需要先写 memsw，调小限制时需要先写 memory
+func setMemoryAndSwap(cgroupPath string, res *resource.ResourceConfig) error {
+	if res.MemorySwap != 0 {
+		if _, err := os.Stat(path.Join(cgroupPath, memorySwapLimitFile)); os.IsNotExist(err) {
+			return fmt.Errorf("memory swap limit is not supported, swap accounting may be disabled in the kernel")
+		}
+	}
+	if res.Memory == 0 || res.MemorySwap == 0 {
+		if res.Memory != 0 {
+			return writeInt(cgroupPath, memoryLimitFile, res.Memory)
+		}
+		if res.MemorySwap != 0 {
+			return writeInt(cgroupPath, memorySwapLimitFile, res.MemorySwap)
+		}
+		return nil
+	}
+	current, err := getCgroupParamUint(cgroupPath, memoryLimitFile)
+	if err != nil {
+		return err
+	}
+	if res.MemorySwap == -1 || current < uint64(res.MemorySwap) {
+		if err = writeInt(cgroupPath, memorySwapLimitFile, res.MemorySwap); err != nil {
+			return err
+		}
+		return writeInt(cgroupPath, memoryLimitFile, res.Memory)
+	}
+	if err = writeInt(cgroupPath, memoryLimitFile, res.Memory); err != nil {
+		return err
+	}
+	return writeInt(cgroupPath, memorySwapLimitFile, res.MemorySwap)
+}
+
 func (s *MemorySubsystem) Apply(cgroupPath string, pid int, config *resource.ResourceConfig) error {
 
 	subsystemCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
@@ -41,10 +104,7 @@ func (s *MemorySubsystem) Apply(cgroupPath string, pid int, config *resource.Res
 		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
 	}
 	//fmt.Println("Pid>", strconv.Itoa(pid))
-	if err := os.WriteFile(path.Join(subsystemCgroupPath, "tasks"), []byte(strconv.Itoa(pid)), constant.Perm0644); err != nil {
-		return fmt.Errorf("set cgroup proc fail %v", err)
-	}
-	return nil
+	return applyPid(subsystemCgroupPath, pid)
 }
 
 func (s *MemorySubsystem) Remove(cgroupPath string) error {
@@ -54,3 +114,34 @@ func (s *MemorySubsystem) Remove(cgroupPath string) error {
 	}
 	return os.RemoveAll(subsystemCgroupPath)
 }
+
+// unlimitedMemory v1 中不限制内存时 memory.limit_in_bytes 的值为一个接近 int64 最大值的数
+const unlimitedMemory = 1 << 62
+
+func (s *MemorySubsystem) GetStats(cgroupPath string, stats *resource.Stats) error {
+	subsystemCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	usage, err := getCgroupParamUint(subsystemCgroupPath, "memory.usage_in_bytes")
+	if err != nil {
+		return err
+	}
+	memoryStat, err := getCgroupParamKeyValue(subsystemCgroupPath, "memory.stat")
+	if err != nil {
+		return err
+	}
+	// 与 docker stats 一致，内存用量不包含可以随时回收的 inactive_file 缓存
+	if inactiveFile := memoryStat["total_inactive_file"]; inactiveFile < usage {
+		usage -= inactiveFile
+	}
+	limit, err := getCgroupParamUint(subsystemCgroupPath, memoryLimitFile)
+	if err != nil {
+		return err
+	}
+	if limit >= unlimitedMemory {
+		limit = 0
+	}
+	stats.Memory.Usage, stats.Memory.Limit = usage, limit
+	return nil
+}
@@ -0,0 +1,72 @@
+package fs
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"path"
+	"runQ/constant"
+)
+
+const memorySubsystem = "memory"
+
+// NotifyOOM 监听 cgroup v1 的 OOM 事件
+// 通过 cgroup.event_control 将 eventfd 注册到 memory.oom_control 上，每次发生 OOM 时内核都会写 eventfd，
+// cgroup 被删除时内核也会写一次 eventfd，此时关闭返回的 channel
+func NotifyOOM(cgroupPath string) (<-chan struct{}, error) {
+	subsystemCgroupPath, err := getCgroupPath(memorySubsystem, cgroupPath, false)
+	if err != nil {
+		return nil, err
+	}
+	oomControl, err := os.Open(path.Join(subsystemCgroupPath, "memory.oom_control"))
+	if err != nil {
+		return nil, err
+	}
+	eventFd, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
+	if err != nil {
+		_ = oomControl.Close()
+		return nil, errors.Wrap(err, "create eventfd")
+	}
+	eventFile := os.NewFile(uintptr(eventFd), "eventfd")
+	eventControlPath := path.Join(subsystemCgroupPath, "cgroup.event_control")
+	data := fmt.Sprintf("%d %d", eventFd, oomControl.Fd())
+	if err = os.WriteFile(eventControlPath, []byte(data), constant.Perm0644); err != nil {
+		_ = eventFile.Close()
+		_ = oomControl.Close()
+		return nil, errors.Wrap(err, "register oom event")
+	}
+	ch := make(chan struct{})
+	go func() {
+		defer func() {
+			close(ch)
+			_ = eventFile.Close()
+			_ = oomControl.Close()
+		}()
+		buf := make([]byte, 8)
+		for {
+			if _, err := eventFile.Read(buf); err != nil {
+				return
+			}
+			// cgroup 已经被删除
+			if _, err := os.Stat(eventControlPath); os.IsNotExist(err) {
+				return
+			}
+			ch <- struct{}{}
+		}
+	}()
+	return ch, nil
+}
+
+// OOMKillCount 读取 cgroup 中被 OOM killer 杀死的进程数，需要 4.13 以上的内核
+func OOMKillCount(cgroupPath string) (uint64, error) {
+	subsystemCgroupPath, err := getCgroupPath(memorySubsystem, cgroupPath, false)
+	if err != nil {
+		return 0, err
+	}
+	oomControl, err := getCgroupParamKeyValue(subsystemCgroupPath, "memory.oom_control")
+	if err != nil {
+		return 0, err
+	}
+	return oomControl["oom_kill"], nil
+}
@@ -6,4 +6,10 @@ var SubsystemIns = []resource.Subsystem{
 	&CpusetSubsystem{},
 	&MemorySubsystem{},
 	&CpuSubsystem{},
+	&CpuacctSubsystem{},
+	&PidsSubsystem{},
+	&BlkioSubsystem{},
+	&DevicesSubsystem{},
+	&HugetlbSubsystem{},
+	&FreezerSubsystem{},
 }
@@ -0,0 +1,204 @@
+package fs
+
+import (
+	"runQ/cgroups/cgroupstest"
+	"runQ/cgroups/resource"
+	"testing"
+)
+
+const testCgroupPath = "runQ/1234567890"
+
+// newFakeCgroupfs 将 subsystem 的挂载点指向伪造的 cgroupfs，并提前创建容器的 cgroup
+func newFakeCgroupfs(t *testing.T) *cgroupstest.FakeCgroupfs {
+	f := cgroupstest.NewV1(t)
+	old := MountInfoPath
+	MountInfoPath = f.MountInfo
+	t.Cleanup(func() { MountInfoPath = old })
+	f.Create(testCgroupPath)
+	return f
+}
+
+func TestSubsystemSet(t *testing.T) {
+	swappiness := uint64(10)
+	tests := []struct {
+		name      string
+		subsystem resource.Subsystem
+		res       *resource.ResourceConfig
+		expected  map[string]string
+	}{
+		{
+			name:      "memory",
+			subsystem: &MemorySubsystem{},
+			res: &resource.ResourceConfig{Memory: 100 << 20, MemorySwap: 200 << 20, MemoryReservation: 50 << 20,
+				MemorySwappiness: &swappiness, OomKillDisable: true},
+			expected: map[string]string{
+				"memory.limit_in_bytes":       "104857600",
+				"memory.memsw.limit_in_bytes": "209715200",
+				"memory.soft_limit_in_bytes":  "52428800",
+				"memory.swappiness":           "10",
+				"memory.oom_control":          "1",
+			},
+		},
+		{
+			name:      "cpu",
+			subsystem: &CpuSubsystem{},
+			res:       &resource.ResourceConfig{CpuShares: 512, CpuPeriod: 50000, CpuQuota: 25000},
+			expected: map[string]string{
+				"cpu.shares":        "512",
+				"cpu.cfs_period_us": "50000",
+				"cpu.cfs_quota_us":  "25000",
+			},
+		},
+		{
+			name:      "cpuset",
+			subsystem: &CpusetSubsystem{},
+			res:       &resource.ResourceConfig{CpuSet: "1-2", CpusetMems: "0"},
+			expected:  map[string]string{"cpuset.cpus": "1-2", "cpuset.mems": "0"},
+		},
+		{
+			name:      "pids",
+			subsystem: &PidsSubsystem{},
+			res:       &resource.ResourceConfig{PidsLimit: 100},
+			expected:  map[string]string{"pids.max": "100"},
+		},
+		{
+			name:      "pids unlimited",
+			subsystem: &PidsSubsystem{},
+			res:       &resource.ResourceConfig{PidsLimit: -1},
+			expected:  map[string]string{"pids.max": "max"},
+		},
+		{
+			name:      "blkio",
+			subsystem: &BlkioSubsystem{},
+			res: &resource.ResourceConfig{BlkioWeight: 300,
+				BlkioThrottleReadBpsDevice: []*resource.ThrottleDevice{{Major: 8, Minor: 0, Rate: 1 << 20}}},
+			expected: map[string]string{
+				"blkio.weight":                   "300",
+				"blkio.throttle.read_bps_device": "8:0 1048576",
+			},
+		},
+		{
+			name:      "devices",
+			subsystem: &DevicesSubsystem{},
+			res: &resource.ResourceConfig{Devices: []*resource.DeviceRule{
+				{Type: resource.DeviceTypeChar, Major: 1, Minor: 3, Permissions: "rwm", Allow: true},
+			}},
+			expected: map[string]string{"devices.deny": "a", "devices.allow": "c 1:3 rwm"},
+		},
+		{
+			name:      "hugetlb",
+			subsystem: &HugetlbSubsystem{},
+			res:       &resource.ResourceConfig{HugetlbLimit: []*resource.HugepageLimit{{PageSize: "2MB", Limit: 20 << 20}}},
+			expected:  map[string]string{"hugetlb.2MB.limit_in_bytes": "20971520"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeCgroupfs(t)
+			if err := tt.subsystem.Set(testCgroupPath, tt.res); err != nil {
+				t.Fatalf("set %s error %v", tt.subsystem.Name(), err)
+			}
+			for file, expected := range tt.expected {
+				if actual := f.ReadFile(tt.subsystem.Name(), testCgroupPath, file); actual != expected {
+					t.Errorf("%s = %q, expected %q", file, actual, expected)
+				}
+			}
+		})
+	}
+}
+
+// TestSubsystemSetWithoutLimit 没有设置限制时不应该创建 cgroup
+func TestSubsystemSetWithoutLimit(t *testing.T) {
+	f := newFakeCgroupfs(t)
+	for _, subsystem := range SubsystemIns {
+		if err := subsystem.Set("runQ/unlimited", &resource.ResourceConfig{}); err != nil {
+			t.Errorf("set %s error %v", subsystem.Name(), err)
+		}
+		if f.Exists(subsystem.Name(), "runQ/unlimited") {
+			t.Errorf("cgroup of %s should not be created", subsystem.Name())
+		}
+	}
+}
+
+func TestSubsystemApplyAndRemove(t *testing.T) {
+	f := newFakeCgroupfs(t)
+	// 设置所有限制，使只在有限制时才加入进程的 subsystem 也会加入进程
+	res := &resource.ResourceConfig{
+		CpuShares:    512,
+		Devices:      resource.DefaultDeviceRules,
+		HugetlbLimit: []*resource.HugepageLimit{{PageSize: "2MB", Limit: 20 << 20}},
+	}
+	for _, subsystem := range SubsystemIns {
+		if err := subsystem.Apply(testCgroupPath, 1234, res); err != nil {
+			t.Fatalf("apply %s error %v", subsystem.Name(), err)
+		}
+		if procs := f.ReadFile(subsystem.Name(), testCgroupPath, "cgroup.procs"); procs != "1234" {
+			t.Errorf("cgroup.procs of %s = %q, expected 1234", subsystem.Name(), procs)
+		}
+	}
+	for _, subsystem := range SubsystemIns {
+		if err := subsystem.Remove(testCgroupPath); err != nil {
+			t.Fatalf("remove %s error %v", subsystem.Name(), err)
+		}
+		if f.Exists(subsystem.Name(), testCgroupPath) {
+			t.Errorf("cgroup of %s should be removed", subsystem.Name())
+		}
+	}
+}
+
+// TestCpusetInherit 新建的 cpuset cgroup 需要从父 cgroup 继承 cpus 和 mems 后才能加入进程
+func TestCpusetInherit(t *testing.T) {
+	f := newFakeCgroupfs(t)
+	if err := (&CpusetSubsystem{}).Apply(testCgroupPath, 1234, &resource.ResourceConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, cgroupPath := range []string{"runQ", testCgroupPath} {
+		if cpus := f.ReadFile("cpuset", cgroupPath, "cpuset.cpus"); cpus != "0-3" {
+			t.Errorf("cpuset.cpus of %s = %q, expected 0-3", cgroupPath, cpus)
+		}
+		if mems := f.ReadFile("cpuset", cgroupPath, "cpuset.mems"); mems != "0" {
+			t.Errorf("cpuset.mems of %s = %q, expected 0", cgroupPath, mems)
+		}
+	}
+}
+
+func TestCpusetUnavailable(t *testing.T) {
+	newFakeCgroupfs(t)
+	if err := (&CpusetSubsystem{}).Set(testCgroupPath, &resource.ResourceConfig{CpuSet: "4"}); err == nil {
+		t.Error("set unavailable cpus should fail")
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	f := newFakeCgroupfs(t)
+	freezer := &FreezerSubsystem{}
+	for _, state := range []resource.FreezerState{resource.Frozen, resource.Thawed} {
+		if err := freezer.Freeze(testCgroupPath, state); err != nil {
+			t.Fatal(err)
+		}
+		if actual := f.ReadFile("freezer", testCgroupPath, "freezer.state"); actual != string(state) {
+			t.Errorf("freezer.state = %q, expected %q", actual, state)
+		}
+	}
+}
+
+func TestMemoryGetStats(t *testing.T) {
+	f := newFakeCgroupfs(t)
+	f.WriteFile("memory", testCgroupPath, "memory.usage_in_bytes", "1048576")
+	f.WriteFile("memory", testCgroupPath, "memory.stat", "cache 0\ntotal_inactive_file 524288\n")
+	stats := &resource.Stats{}
+	if err := (&MemorySubsystem{}).GetStats(testCgroupPath, stats); err != nil {
+		t.Fatal(err)
+	}
+	// 内存用量不包含 inactive_file，没有限制时上限为 0
+	if stats.Memory.Usage != 524288 || stats.Memory.Limit != 0 {
+		t.Errorf("memory stats = %+v, expected usage 524288 and limit 0", stats.Memory)
+	}
+}
+
+func TestGetCgroupPathNotMounted(t *testing.T) {
+	newFakeCgroupfs(t)
+	if _, err := getCgroupPath("net_cls", testCgroupPath, true); err == nil {
+		t.Error("get cgroup path of unmounted subsystem should fail")
+	}
+}
@@ -2,18 +2,30 @@ package fs
 
 import (
 	"bufio"
+	"fmt"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"os"
 	"path"
 	"runQ/constant"
+	"strconv"
 	"strings"
 )
 
-const mountPointIndex = 4
+const (
+	mountPointIndex = 4
+	procsFile       = "cgroup.procs"
+)
+
+// MountInfoPath 查找 v1 各个 subsystem 挂载点时读取的 mountinfo 文件，测试时可以替换为伪造的 mountinfo
+var MountInfoPath = constant.MOUNTINFO
 
 func getCgroupPath(subsystem, cgroupPath string, autoCreate bool) (string, error) {
 	cgroupRoot := findCgroupMountpoint(subsystem)
+	// 没有挂载的 subsystem(e.g. 部分系统没有 hugetlb)不能拼接成相对路径，否则会在当前目录下创建和删除目录
+	if cgroupRoot == "" {
+		return "", errors.Errorf("cgroup subsystem %s is not mounted", subsystem)
+	}
 	absPath := path.Join(cgroupRoot, cgroupPath)
 	if !autoCreate {
 		return absPath, nil
@@ -21,8 +33,8 @@ func getCgroupPath(subsystem, cgroupPath string, autoCreate bool) (string, error
 
 	_, err := os.Stat(absPath)
 	if err != nil && os.IsNotExist(err) {
-		err = os.Mkdir(absPath, constant.Perm0755)
-		//fmt.Println("11")
+		// 容器的 cgroup 路径为 runQ/{containerId} 这样的多级目录，需要逐级创建
+		err = os.MkdirAll(absPath, constant.Perm0755)
 		return absPath, err
 	}
 	return absPath, errors.Wrap(err, "create cgroup")
@@ -31,7 +43,7 @@ func getCgroupPath(subsystem, cgroupPath string, autoCreate bool) (string, error
 func findCgroupMountpoint(subsystem string) string {
 	// /proc/self/mountinfo 为当前进程的 mountinfo 信息
 	// 可以直接通过 cat /proc/self/mountinfo 命令查看
-	f, err := os.Open(constant.MOUNTINFO)
+	f, err := os.Open(MountInfoPath)
 	if err != nil {
 		return ""
 	}
@@ -62,3 +74,114 @@ func findCgroupMountpoint(subsystem string) string {
 	}
 	return ""
 }
+
+// getCgroupParamUint 读取 cgroup 接口文件中的单个数值，"max" 表示不限制，返回 0
+func getCgroupParamUint(cgroupPath, file string) (uint64, error) {
+	content, err := os.ReadFile(path.Join(cgroupPath, file))
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// applyPid 将进程加入 cgroup，写入 cgroup.procs 会移动进程的所有线程，而写入 tasks 只会移动单个线程
+func applyPid(cgroupPath string, pid int) error {
+	if err := os.WriteFile(path.Join(cgroupPath, procsFile), []byte(strconv.Itoa(pid)), constant.Perm0644); err != nil {
+		return fmt.Errorf("set cgroup proc fail %v", err)
+	}
+	return nil
+}
+
+// writeInt 向 cgroup 接口文件写入数值
+func writeInt(cgroupPath, file string, value int64) error {
+	if err := os.WriteFile(path.Join(cgroupPath, file), []byte(strconv.FormatInt(value, 10)), constant.Perm0644); err != nil {
+		return errors.Wrapf(err, "set cgroup %s", file)
+	}
+	return nil
+}
+
+// getCgroupParamKeyValue 读取 memory.stat、cpu.stat 这类每行为 "key value" 格式的接口文件
+func getCgroupParamKeyValue(cgroupPath, file string) (map[string]uint64, error) {
+	content, err := os.ReadFile(path.Join(cgroupPath, file))
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]uint64{}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse %s", file)
+		}
+		result[fields[0]] = value
+	}
+	return result, nil
+}
+
+// GetPids 获取 cgroup 中的所有进程，容器的进程总是会加入 memory subsystem，从这里读取即可
+func GetPids(cgroupPath string) ([]int, error) {
+	subsystemCgroupPath, err := getCgroupPath(memorySubsystem, cgroupPath, false)
+	if err != nil {
+		return nil, err
+	}
+	return readPids(path.Join(subsystemCgroupPath, procsFile))
+}
+
+// ProcsFiles 容器 init 进程实际加入的各个 subsystem 的 cgroup.procs 文件
+// 部分 subsystem 只有设置了限制时才会加入进程，没有加入的跳过，共用挂载点的 subsystem(e.g. cpu,cpuacct)只返回一次
+func ProcsFiles(cgroupPath string, pid int) []string {
+	var files []string
+	for _, subSysIns := range SubsystemIns {
+		subsysCgroupPath, err := getCgroupPath(subSysIns.Name(), cgroupPath, false)
+		if err != nil {
+			continue
+		}
+		file := path.Join(subsysCgroupPath, procsFile)
+		if containsString(files, file) {
+			continue
+		}
+		pids, err := readPids(file)
+		if err != nil {
+			continue
+		}
+		for _, p := range pids {
+			if p == pid {
+				files = append(files, file)
+				break
+			}
+		}
+	}
+	return files
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func readPids(file string) ([]int, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, field := range strings.Fields(string(content)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse pid %s", field)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
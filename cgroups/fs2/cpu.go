@@ -1 +1,95 @@
-package fs
+package fs2
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+	"strconv"
+)
+
+type CpuSubsystem struct {
+}
+
+func (s *CpuSubsystem) Name() string {
+	return "cpu"
+}
+
+func (s *CpuSubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
+	if !res.HasCpuLimit() {
+		return nil
+	}
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	if res.CpuShares != 0 {
+		weight := strconv.FormatUint(convertCPUSharesToWeight(res.CpuShares), 10)
+		if err = os.WriteFile(path.Join(subsysCgroupPath, "cpu.weight"), []byte(weight), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup cpu weight fail %v", err)
+		}
+	}
+
+	if res.CpuQuota != 0 || res.CpuPeriod != 0 {
+		if err = os.WriteFile(path.Join(subsysCgroupPath, "cpu.max"), []byte(cpuMax(res)), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup cpu max fail %v", err)
+		}
+	}
+	return nil
+}
+
+// cpuMax 生成 cpu.max 的内容，格式为 "$MAX $PERIOD"，同时包含了 v1 中 cpu.cfs_quota_us 和 cpu.cfs_period_us 的内容
+// $MAX 为 max 表示不限制，只设置 quota 时可以省略 $PERIOD
+func cpuMax(res *resource.ResourceConfig) string {
+	quota := "max"
+	if res.CpuQuota > 0 {
+		quota = strconv.FormatInt(res.CpuQuota, 10)
+	}
+	if res.CpuPeriod == 0 {
+		return quota
+	}
+	return fmt.Sprintf("%s %d", quota, res.CpuPeriod)
+}
+
+func (s *CpuSubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
+	if !res.HasCpuLimit() {
+		return nil
+	}
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return fmt.Errorf("get cgroup %s error: %v", cgroupPath, err)
+	}
+	return applyPid(subsysCgroupPath, pid)
+}
+
+func (s *CpuSubsystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsysCgroupPath)
+}
+
+// convertCPUSharesToWeight 将 v1 的 cpu.shares [2-262144] 换算为 v2 的 cpu.weight [1-10000]
+func convertCPUSharesToWeight(shares uint64) uint64 {
+	if shares == 0 {
+		return 0
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
+
+// GetStats cpu.stat 是 cgroup 的核心接口文件，不需要开启 cpu controller 也可以读取
+func (s *CpuSubsystem) GetStats(cgroupPath string, stats *resource.Stats) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	cpuStat, err := getCgroupParamKeyValue(subsysCgroupPath, "cpu.stat")
+	if err != nil {
+		return err
+	}
+	// v2 中的单位是微秒，统一换算为纳秒
+	stats.Cpu.UsageTotal = cpuStat["usage_usec"] * 1000
+	return nil
+}
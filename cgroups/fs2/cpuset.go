@@ -1 +1,99 @@
-package fs
+package fs2
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+	"strings"
+)
+
+type CpusetSubsystem struct {
+}
+
+func (s *CpusetSubsystem) Name() string {
+	return "cpuset"
+}
+
+// Set v2 中 cpuset.cpus 和 cpuset.mems 为空时自动继承父 cgroup，不需要像 v1 一样手动初始化
+func (s *CpusetSubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
+	if !res.HasCpusetLimit() {
+		return nil
+	}
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	parent := path.Dir(subsysCgroupPath)
+	if res.CpuSet != "" {
+		if err = checkEffective(parent, "cpus", res.CpuSet); err != nil {
+			return err
+		}
+		if err = os.WriteFile(path.Join(subsysCgroupPath, "cpuset.cpus"), []byte(res.CpuSet), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup cpuset fail %v", err)
+		}
+	}
+	if res.CpusetMems != "" {
+		if err = checkEffective(parent, "mems", res.CpusetMems); err != nil {
+			return err
+		}
+		if err = os.WriteFile(path.Join(subsysCgroupPath, "cpuset.mems"), []byte(res.CpusetMems), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup cpuset mems fail %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *CpusetSubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
+	if !res.HasCpusetLimit() {
+		return nil
+	}
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+	return applyPid(subsysCgroupPath, pid)
+}
+
+func (s *CpusetSubsystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsysCgroupPath)
+}
+
+// GetStats 没有开启 cpuset controller 时不存在 cpuset.*.effective 文件，此时不统计
+func (s *CpusetSubsystem) GetStats(cgroupPath string, stats *resource.Stats) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	cpus, err := os.ReadFile(path.Join(subsysCgroupPath, "cpuset.cpus.effective"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	mems, err := os.ReadFile(path.Join(subsysCgroupPath, "cpuset.mems.effective"))
+	if err != nil {
+		return err
+	}
+	stats.Cpuset.EffectiveCpus = strings.TrimSpace(string(cpus))
+	stats.Cpuset.EffectiveMems = strings.TrimSpace(string(mems))
+	return nil
+}
+
+// checkEffective 检查请求的 cpus/mems 是否在父 cgroup 实际可用的范围内
+func checkEffective(parent, kind, list string) error {
+	available, err := os.ReadFile(path.Join(parent, "cpuset."+kind+".effective"))
+	if err != nil {
+		return err
+	}
+	if err = resource.CheckCpuListSubset(list, string(available)); err != nil {
+		return errors.WithMessagef(err, "invalid cpuset %s", kind)
+	}
+	return nil
+}
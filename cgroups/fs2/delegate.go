@@ -0,0 +1,58 @@
+package fs2
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"path"
+	"strings"
+)
+
+// ProcSelfCgroup 当前进程所属 cgroup 的描述文件，测试时可以替换
+var ProcSelfCgroup = "/proc/self/cgroup"
+
+// CurrentCgroupPath 当前进程在统一层级中的路径，即 /proc/self/cgroup 中 0:: 开头的那一行
+func CurrentCgroupPath() (string, error) {
+	file, err := os.Open(ProcSelfCgroup)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if p, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return p, nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", errors.Wrapf(err, "read %s", ProcSelfCgroup)
+	}
+	return "", fmt.Errorf("no cgroup v2 entry in %s", ProcSelfCgroup)
+}
+
+// DelegatedRoot 普通用户可以管理的 cgroup 子树的根
+// systemd 会把 user@<uid>.service 委派给用户，从当前进程所在的 cgroup 逐级向上，
+// 最顶层的 cgroup.procs 和 cgroup.subtree_control 都可写的 cgroup 就是委派的根
+func DelegatedRoot() (string, error) {
+	current, err := CurrentCgroupPath()
+	if err != nil {
+		return "", err
+	}
+	delegated := ""
+	for p := path.Clean(current); p != "/" && p != "."; p = path.Dir(p) {
+		if !writable(path.Join(UnifiedMountpoint, p, procsFile)) || !writable(path.Join(UnifiedMountpoint, p, subtreeControlFile)) {
+			break
+		}
+		delegated = p
+	}
+	if delegated == "" {
+		return "", fmt.Errorf("cgroup %s is not delegated to uid %d", current, os.Geteuid())
+	}
+	return delegated, nil
+}
+
+func writable(file string) bool {
+	return unix.Access(file, unix.W_OK) == nil
+}
@@ -0,0 +1,33 @@
+package fs2
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCurrentCgroupPath(t *testing.T) {
+	file := path.Join(t.TempDir(), "cgroup")
+	content := "12:memory:/user.slice\n0::/user.slice/user-1000.slice/user@1000.service/app.slice/run.scope\n"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := ProcSelfCgroup
+	ProcSelfCgroup = file
+	t.Cleanup(func() { ProcSelfCgroup = old })
+
+	p, err := CurrentCgroupPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != "/user.slice/user-1000.slice/user@1000.service/app.slice/run.scope" {
+		t.Errorf("unexpected cgroup path %s", p)
+	}
+
+	if err = os.WriteFile(file, []byte("12:memory:/user.slice\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = CurrentCgroupPath(); err == nil {
+		t.Error("expected error for cgroup v1 only file")
+	}
+}
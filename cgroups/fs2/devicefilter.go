@@ -0,0 +1,135 @@
+package fs2
+
+import (
+	"encoding/binary"
+	"golang.org/x/sys/unix"
+	"runQ/cgroups/resource"
+	"strings"
+	"unsafe"
+)
+
+// bpfInsn 对应内核中的 struct bpf_insn
+type bpfInsn struct {
+	Code uint8
+	Regs uint8 // 低 4 位为目标寄存器，高 4 位为源寄存器
+	Off  int16
+	Imm  int32
+}
+
+const (
+	// BPF_PROG_TYPE_CGROUP_DEVICE 程序的参数 struct bpf_cgroup_dev_ctx 中各个字段的偏移
+	// access_type 的低 16 位为设备类型，高 16 位为访问类型
+	devCtxAccessType = 0
+	devCtxMajor      = 4
+	devCtxMinor      = 8
+
+	regCtx    = 1
+	regType   = 2
+	regAccess = 3
+	regMajor  = 4
+	regMinor  = 5
+	regTmp    = 1 // 读取完参数后 r1 不再使用，作为临时寄存器
+	regRet    = 0
+)
+
+func ldxW(dst, src uint8, off int16) bpfInsn {
+	return bpfInsn{Code: unix.BPF_LDX | unix.BPF_MEM | unix.BPF_W, Regs: dst | src<<4, Off: off}
+}
+
+func alu64Imm(op, dst uint8, imm int32) bpfInsn {
+	return bpfInsn{Code: unix.BPF_ALU64 | op | unix.BPF_K, Regs: dst, Imm: imm}
+}
+
+func movReg(dst, src uint8) bpfInsn {
+	return bpfInsn{Code: unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_X, Regs: dst | src<<4}
+}
+
+func jneImm(dst uint8, imm int32, off int16) bpfInsn {
+	return bpfInsn{Code: unix.BPF_JMP | unix.BPF_JNE | unix.BPF_K, Regs: dst, Off: off, Imm: imm}
+}
+
+func jneReg(dst, src uint8, off int16) bpfInsn {
+	return bpfInsn{Code: unix.BPF_JMP | unix.BPF_JNE | unix.BPF_X, Regs: dst | src<<4, Off: off}
+}
+
+func exitInsn() bpfInsn {
+	return bpfInsn{Code: unix.BPF_JMP | unix.BPF_EXIT}
+}
+
+// compileDeviceFilter 将设备规则编译为 eBPF 程序，返回 1 表示允许访问，0 表示拒绝
+// 每条规则编译为一个独立的代码块，不匹配时跳到下一个代码块，所有规则都不匹配时拒绝访问，等价于 v1 中先 deny a 再 allow
+func compileDeviceFilter(rules []*resource.DeviceRule) []bpfInsn {
+	insns := []bpfInsn{
+		ldxW(regType, regCtx, devCtxAccessType),
+		alu64Imm(unix.BPF_AND, regType, 0xFFFF),
+		ldxW(regAccess, regCtx, devCtxAccessType),
+		alu64Imm(unix.BPF_RSH, regAccess, 16),
+		ldxW(regMajor, regCtx, devCtxMajor),
+		ldxW(regMinor, regCtx, devCtxMinor),
+	}
+	for _, rule := range rules {
+		insns = append(insns, compileDeviceRule(rule)...)
+	}
+	return append(insns, alu64Imm(unix.BPF_MOV, regRet, 0), exitInsn())
+}
+
+// compileDeviceRule 生成单条规则的代码块，跳转指令中的偏移在代码块生成完之后统一填写
+func compileDeviceRule(rule *resource.DeviceRule) []bpfInsn {
+	var block []bpfInsn
+	var jumps []int
+	jumpToNext := func(insn bpfInsn) {
+		jumps = append(jumps, len(block))
+		block = append(block, insn)
+	}
+	switch rule.Type {
+	case resource.DeviceTypeChar:
+		jumpToNext(jneImm(regType, unix.BPF_DEVCG_DEV_CHAR, 0))
+	case resource.DeviceTypeBlock:
+		jumpToNext(jneImm(regType, unix.BPF_DEVCG_DEV_BLOCK, 0))
+	}
+	// 请求的访问类型必须是规则允许的访问类型的子集
+	if access := deviceAccess(rule.Permissions); access != unix.BPF_DEVCG_ACC_READ|unix.BPF_DEVCG_ACC_WRITE|unix.BPF_DEVCG_ACC_MKNOD {
+		block = append(block, movReg(regTmp, regAccess), alu64Imm(unix.BPF_AND, regTmp, access))
+		jumpToNext(jneReg(regTmp, regAccess, 0))
+	}
+	if rule.Type != resource.DeviceTypeAll && rule.Major != resource.DeviceWildcard {
+		jumpToNext(jneImm(regMajor, int32(rule.Major), 0))
+	}
+	if rule.Type != resource.DeviceTypeAll && rule.Minor != resource.DeviceWildcard {
+		jumpToNext(jneImm(regMinor, int32(rule.Minor), 0))
+	}
+	ret := int32(0)
+	if rule.Allow {
+		ret = 1
+	}
+	block = append(block, alu64Imm(unix.BPF_MOV, regRet, ret), exitInsn())
+	for _, i := range jumps {
+		block[i].Off = int16(len(block) - i - 1)
+	}
+	return block
+}
+
+func deviceAccess(permissions string) int32 {
+	var access int32
+	if strings.Contains(permissions, "r") {
+		access |= unix.BPF_DEVCG_ACC_READ
+	}
+	if strings.Contains(permissions, "w") {
+		access |= unix.BPF_DEVCG_ACC_WRITE
+	}
+	if strings.Contains(permissions, "m") {
+		access |= unix.BPF_DEVCG_ACC_MKNOD
+	}
+	return access
+}
+
+// encodeInsns 按照本机字节序将指令编码为内核需要的格式
+func encodeInsns(insns []bpfInsn) []byte {
+	buf := make([]byte, 0, len(insns)*int(unsafe.Sizeof(bpfInsn{})))
+	for _, insn := range insns {
+		buf = append(buf, insn.Code, insn.Regs)
+		buf = binary.NativeEndian.AppendUint16(buf, uint16(insn.Off))
+		buf = binary.NativeEndian.AppendUint32(buf, uint32(insn.Imm))
+	}
+	return buf
+}
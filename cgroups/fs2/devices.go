@@ -0,0 +1,113 @@
+package fs2
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+	"runtime"
+	"unsafe"
+)
+
+// deviceFilterLoader 加载设备过滤程序的函数，测试时可以替换，检查是否加载了程序
+var deviceFilterLoader = loadDeviceFilter
+
+// DevicesSubsystem v2 中没有 devices controller，需要向 cgroup 挂载 BPF_PROG_TYPE_CGROUP_DEVICE 类型的 eBPF 程序
+type DevicesSubsystem struct {
+}
+
+func (s *DevicesSubsystem) Name() string {
+	return "devices"
+}
+
+// Set 不使用 BPF_F_ALLOW_MULTI 挂载，再次 Set 时(e.g. update)新的程序会替换掉旧的程序
+// rootless 模式下普通用户没有 CAP_BPF、CAP_SYS_ADMIN，无法加载程序，user namespace 中也无法 mknod，跳过设备白名单
+func (s *DevicesSubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
+	if len(res.Devices) == 0 || constant.Rootless {
+		return nil
+	}
+	subsysCgroupPath, err := getCgroupPath("", cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	progFd, err := deviceFilterLoader(compileDeviceFilter(res.Devices))
+	if err != nil {
+		return err
+	}
+	defer unix.Close(progFd)
+	cgroupFd, err := unix.Open(subsysCgroupPath, unix.O_DIRECTORY|unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return errors.Wrapf(err, "open cgroup %s", subsysCgroupPath)
+	}
+	defer unix.Close(cgroupFd)
+	return attachDeviceFilter(progFd, cgroupFd)
+}
+
+// Apply 进程已经由其他 subsystem 加入 cgroup
+func (s *DevicesSubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
+	return nil
+}
+
+// Remove cgroup 目录删除后挂载的程序会被内核自动释放
+func (s *DevicesSubsystem) Remove(cgroupPath string) error {
+	return nil
+}
+
+// bpfProgLoadAttr 对应 union bpf_attr 中 BPF_PROG_LOAD 使用的部分
+type bpfProgLoadAttr struct {
+	progType    uint32
+	insnCnt     uint32
+	insns       uint64
+	license     uint64
+	logLevel    uint32
+	logSize     uint32
+	logBuf      uint64
+	kernVersion uint32
+	progFlags   uint32
+}
+
+// bpfProgAttachAttr 对应 union bpf_attr 中 BPF_PROG_ATTACH 使用的部分
+type bpfProgAttachAttr struct {
+	targetFd    uint32
+	attachBpfFd uint32
+	attachType  uint32
+	attachFlags uint32
+}
+
+const bpfLogSize = 64 * 1024
+
+func loadDeviceFilter(insns []bpfInsn) (int, error) {
+	code := encodeInsns(insns)
+	license := []byte("Apache\x00")
+	logBuf := make([]byte, bpfLogSize)
+	attr := bpfProgLoadAttr{
+		progType: unix.BPF_PROG_TYPE_CGROUP_DEVICE,
+		insnCnt:  uint32(len(insns)),
+		insns:    uint64(uintptr(unsafe.Pointer(&code[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+		logLevel: 1,
+		logSize:  bpfLogSize,
+		logBuf:   uint64(uintptr(unsafe.Pointer(&logBuf[0]))),
+	}
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_LOAD, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	runtime.KeepAlive(code)
+	runtime.KeepAlive(license)
+	if errno != 0 {
+		// 校验失败时 verifier 的日志写在 logBuf 中
+		return -1, fmt.Errorf("load device filter error: %v, verifier log: %s", errno, unix.ByteSliceToString(logBuf))
+	}
+	return int(fd), nil
+}
+
+func attachDeviceFilter(progFd, cgroupFd int) error {
+	attr := bpfProgAttachAttr{
+		targetFd:    uint32(cgroupFd),
+		attachBpfFd: uint32(progFd),
+		attachType:  unix.BPF_CGROUP_DEVICE,
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_ATTACH, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr)); errno != 0 {
+		return fmt.Errorf("attach device filter error: %v", errno)
+	}
+	return nil
+}
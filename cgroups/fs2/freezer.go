@@ -0,0 +1,72 @@
+package fs2
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+	"time"
+)
+
+const (
+	freezeFile = "cgroup.freeze"
+	eventsFile = "cgroup.events"
+	// freezeTimeout 等待冻结完成的最长时间
+	freezeTimeout       = 10 * time.Second
+	freezeCheckInterval = 10 * time.Millisecond
+)
+
+// FreezerSubsystem v2 中没有 freezer controller，cgroup.freeze 是每个非根 cgroup 都有的核心接口文件，
+// 进程已经由其他 subsystem 加入 cgroup，目录也由其他 subsystem 删除，所以这里只实现 Freeze
+type FreezerSubsystem struct {
+}
+
+func (s *FreezerSubsystem) Name() string {
+	return "freezer"
+}
+
+func (s *FreezerSubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
+	return nil
+}
+
+func (s *FreezerSubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
+	return nil
+}
+
+func (s *FreezerSubsystem) Remove(cgroupPath string) error {
+	return nil
+}
+
+// Freeze 写入 cgroup.freeze 后，等待 cgroup.events 中的 frozen 变为对应的值才算完成
+func (s *FreezerSubsystem) Freeze(cgroupPath string, state resource.FreezerState) error {
+	subsysCgroupPath, err := getCgroupPath("", cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	value, expected := "0", uint64(0)
+	if state == resource.Frozen {
+		value, expected = "1", 1
+	}
+	if err = os.WriteFile(path.Join(subsysCgroupPath, freezeFile), []byte(value), constant.Perm0644); err != nil {
+		return errors.Wrapf(err, "set cgroup %s", freezeFile)
+	}
+	deadline := time.Now().Add(freezeTimeout)
+	for {
+		events, err := getCgroupParamKeyValue(subsysCgroupPath, eventsFile)
+		if err != nil {
+			return err
+		}
+		if events["frozen"] == expected {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if state == resource.Frozen {
+				_ = os.WriteFile(path.Join(subsysCgroupPath, freezeFile), []byte("0"), constant.Perm0644)
+			}
+			return fmt.Errorf("timeout waiting for cgroup to be %s", state)
+		}
+		time.Sleep(freezeCheckInterval)
+	}
+}
@@ -0,0 +1,55 @@
+package fs2
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+	"strconv"
+)
+
+type HugetlbSubsystem struct {
+}
+
+func (s *HugetlbSubsystem) Name() string {
+	return "hugetlb"
+}
+
+// Set v2 中大页上限写入 hugetlb.{size}.max
+func (s *HugetlbSubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
+	if !res.HasHugetlbLimit() {
+		return nil
+	}
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	for _, limit := range res.HugetlbLimit {
+		file := fmt.Sprintf("hugetlb.%s.max", limit.PageSize)
+		if err = os.WriteFile(path.Join(subsysCgroupPath, file), []byte(strconv.FormatUint(limit.Limit, 10)), constant.Perm0644); err != nil {
+			return errors.Wrapf(err, "set cgroup %s", file)
+		}
+	}
+	return nil
+}
+
+func (s *HugetlbSubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
+	if !res.HasHugetlbLimit() {
+		return nil
+	}
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+	return applyPid(subsysCgroupPath, pid)
+}
+
+func (s *HugetlbSubsystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsysCgroupPath)
+}
@@ -0,0 +1,150 @@
+package fs2
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+	"strconv"
+	"strings"
+)
+
+// IoSubsystem cgroup v2 的 io controller，对应 v1 的 blkio subsystem
+type IoSubsystem struct {
+}
+
+func (s *IoSubsystem) Name() string {
+	return "io"
+}
+
+func (s *IoSubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
+	if !res.HasBlkioLimit() {
+		return nil
+	}
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	if err = setIoWeight(subsysCgroupPath, res); err != nil {
+		return err
+	}
+	// io.max 中每个设备一行，e.g. "8:0 rbps=10485760 wiops=100"，未写入的 key 保持不变
+	throttles := []struct {
+		key     string
+		devices []*resource.ThrottleDevice
+	}{
+		{"rbps", res.BlkioThrottleReadBpsDevice},
+		{"wbps", res.BlkioThrottleWriteBpsDevice},
+		{"riops", res.BlkioThrottleReadIOPSDevice},
+		{"wiops", res.BlkioThrottleWriteIOPSDevice},
+	}
+	for _, throttle := range throttles {
+		for _, td := range throttle.devices {
+			line := fmt.Sprintf("%d:%d %s=%d", td.Major, td.Minor, throttle.key, td.Rate)
+			if err = os.WriteFile(path.Join(subsysCgroupPath, "io.max"), []byte(line), constant.Perm0644); err != nil {
+				return fmt.Errorf("set cgroup io.max fail %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// setIoWeight 设置 IO 权重，优先使用 BFQ 调度器的 io.bfq.weight，其取值范围与 v1 的 blkio.weight 相同
+// 否则使用 io.weight，需要将 [10-1000] 换算到 [1-10000]
+func setIoWeight(subsysCgroupPath string, res *resource.ResourceConfig) error {
+	if res.BlkioWeight == 0 && len(res.BlkioWeightDevice) == 0 {
+		return nil
+	}
+	weightFile, convert := "io.bfq.weight", false
+	if _, err := os.Stat(path.Join(subsysCgroupPath, weightFile)); os.IsNotExist(err) {
+		weightFile, convert = "io.weight", true
+	}
+	weight := func(w uint16) uint64 {
+		if convert {
+			return convertBlkIOToIOWeight(w)
+		}
+		return uint64(w)
+	}
+	if res.BlkioWeight != 0 {
+		value := "default " + strconv.FormatUint(weight(res.BlkioWeight), 10)
+		if err := os.WriteFile(path.Join(subsysCgroupPath, weightFile), []byte(value), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup %s fail %v", weightFile, err)
+		}
+	}
+	for _, wd := range res.BlkioWeightDevice {
+		value := fmt.Sprintf("%d:%d %d", wd.Major, wd.Minor, weight(wd.Weight))
+		if err := os.WriteFile(path.Join(subsysCgroupPath, weightFile), []byte(value), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup %s fail %v", weightFile, err)
+		}
+	}
+	return nil
+}
+
+// Apply 即使没有设置 IO 限制也开启 io controller，用于统计容器的块设备读写
+func (s *IoSubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+	return applyPid(subsysCgroupPath, pid)
+}
+
+func (s *IoSubsystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsysCgroupPath)
+}
+
+// convertBlkIOToIOWeight 将 v1 的 blkio.weight [10-1000] 换算为 v2 的 io.weight [1-10000]
+func convertBlkIOToIOWeight(blkioWeight uint16) uint64 {
+	if blkioWeight == 0 {
+		return 0
+	}
+	return 1 + (uint64(blkioWeight)-10)*9999/990
+}
+
+// GetStats 读取 io.stat，格式为每行 "8:0 rbytes=4096 wbytes=0 rios=1 wios=0 dbytes=0 dios=0"
+func (s *IoSubsystem) GetStats(cgroupPath string, stats *resource.Stats) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(path.Join(subsysCgroupPath, "io.stat"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		device := &resource.BlkioDeviceStats{}
+		if _, err = fmt.Sscanf(fields[0], "%d:%d", &device.Major, &device.Minor); err != nil {
+			continue
+		}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value, err := strconv.ParseUint(kv[1], 10, 64)
+			if err != nil {
+				return errors.Wrap(err, "parse io.stat")
+			}
+			switch kv[0] {
+			case "rbytes":
+				device.ReadBytes = value
+			case "wbytes":
+				device.WriteBytes = value
+			}
+		}
+		stats.Blkio.Add(device)
+	}
+	return nil
+}
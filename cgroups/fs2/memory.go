@@ -1 +1,120 @@
-package fs
+package fs2
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+	"strconv"
+)
+
+type MemorySubsystem struct {
+}
+
+func (s *MemorySubsystem) Name() string {
+	return "memory"
+}
+
+func (s *MemorySubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
+	if !res.HasMemoryLimit() {
+		return nil
+	}
+	subsystemCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	// v2 中 memory.swap.max 只限制 swap 的用量，而 MemorySwap 是内存和 swap 的总和，需要先写 memory.max 再换算 swap
+	if res.Memory != 0 {
+		if err = writeLimit(subsystemCgroupPath, "memory.max", res.Memory); err != nil {
+			return err
+		}
+	}
+	if swap, ok := convertMemorySwapToV2(res); ok {
+		if _, err = os.Stat(path.Join(subsystemCgroupPath, "memory.swap.max")); os.IsNotExist(err) {
+			return fmt.Errorf("memory swap limit is not supported, swap accounting may be disabled in the kernel")
+		}
+		if err = writeLimit(subsystemCgroupPath, "memory.swap.max", swap); err != nil {
+			return err
+		}
+	}
+	if res.MemoryReservation != 0 {
+		if err = writeLimit(subsystemCgroupPath, "memory.low", res.MemoryReservation); err != nil {
+			return err
+		}
+	}
+	// 以下几项在 v2 中已经没有对应的接口
+	if res.MemorySwappiness != nil {
+		log.Warnf("memory swappiness is not supported in cgroup v2, ignored")
+	}
+	if res.OomKillDisable {
+		log.Warnf("oom kill disable is not supported in cgroup v2, ignored")
+	}
+	if res.KernelMemory != 0 || res.KernelMemoryTCP != 0 {
+		log.Warnf("kernel memory limit is not supported in cgroup v2, ignored")
+	}
+	return nil
+}
+
+// convertMemorySwapToV2 将内存+swap 的总上限换算为 memory.swap.max，-1 表示不限制
+func convertMemorySwapToV2(res *resource.ResourceConfig) (int64, bool) {
+	switch {
+	case res.MemorySwap == 0:
+		return 0, false
+	case res.MemorySwap == -1:
+		return -1, true
+	default:
+		return res.MemorySwap - res.Memory, true
+	}
+}
+
+// writeLimit 写入内存上限，-1 在 v2 中需要写成 max
+func writeLimit(cgroupPath, file string, value int64) error {
+	limit := "max"
+	if value != -1 {
+		limit = strconv.FormatInt(value, 10)
+	}
+	if err := os.WriteFile(path.Join(cgroupPath, file), []byte(limit), constant.Perm0644); err != nil {
+		return errors.Wrapf(err, "set cgroup %s", file)
+	}
+	return nil
+}
+
+func (s *MemorySubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
+	subsystemCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+	return applyPid(subsystemCgroupPath, pid)
+}
+
+func (s *MemorySubsystem) Remove(cgroupPath string) error {
+	subsystemCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsystemCgroupPath)
+}
+
+func (s *MemorySubsystem) GetStats(cgroupPath string, stats *resource.Stats) error {
+	subsystemCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	usage, err := getCgroupParamUint(subsystemCgroupPath, "memory.current")
+	if err != nil {
+		return err
+	}
+	memoryStat, err := getCgroupParamKeyValue(subsystemCgroupPath, "memory.stat")
+	if err != nil {
+		return err
+	}
+	if inactiveFile := memoryStat["inactive_file"]; inactiveFile < usage {
+		usage -= inactiveFile
+	}
+	stats.Memory.Usage = usage
+	stats.Memory.Limit, err = getCgroupParamUint(subsystemCgroupPath, "memory.max")
+	return err
+}
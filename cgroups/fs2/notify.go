@@ -0,0 +1,78 @@
+package fs2
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"path"
+	"unsafe"
+)
+
+const memoryEventsFile = "memory.events"
+
+// NotifyOOM 监听 cgroup v2 的 OOM 事件
+// v2 中没有 cgroup.event_control，memory.events 中的计数变化时内核会产生文件修改事件，通过 inotify 监听，
+// 每当 oom_kill 计数增加时发送一次通知，cgroup 被删除时关闭返回的 channel
+func NotifyOOM(cgroupPath string) (<-chan struct{}, error) {
+	subsystemCgroupPath, err := getCgroupPath("", cgroupPath, false)
+	if err != nil {
+		return nil, err
+	}
+	count, err := OOMKillCount(cgroupPath)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, errors.Wrap(err, "inotify init")
+	}
+	if _, err = unix.InotifyAddWatch(fd, path.Join(subsystemCgroupPath, memoryEventsFile), unix.IN_MODIFY); err != nil {
+		_ = unix.Close(fd)
+		return nil, errors.Wrap(err, "inotify add watch")
+	}
+	inotifyFile := os.NewFile(uintptr(fd), "inotify")
+	ch := make(chan struct{})
+	go func() {
+		defer func() {
+			close(ch)
+			_ = inotifyFile.Close()
+		}()
+		buf := make([]byte, unix.SizeofInotifyEvent*16)
+		for {
+			n, err := inotifyFile.Read(buf)
+			if err != nil {
+				return
+			}
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				offset += unix.SizeofInotifyEvent + int(event.Len)
+				// 被监听的文件已经删除，即 cgroup 被删除
+				if event.Mask&unix.IN_IGNORED != 0 {
+					return
+				}
+				current, err := OOMKillCount(cgroupPath)
+				if err != nil {
+					return
+				}
+				if current > count {
+					count = current
+					ch <- struct{}{}
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// OOMKillCount 读取 cgroup 中被 OOM killer 杀死的进程数
+func OOMKillCount(cgroupPath string) (uint64, error) {
+	subsystemCgroupPath, err := getCgroupPath("", cgroupPath, false)
+	if err != nil {
+		return 0, err
+	}
+	events, err := getCgroupParamKeyValue(subsystemCgroupPath, memoryEventsFile)
+	if err != nil {
+		return 0, err
+	}
+	return events["oom_kill"], nil
+}
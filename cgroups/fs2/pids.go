@@ -0,0 +1,68 @@
+package fs2
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+	"strconv"
+)
+
+type PidsSubsystem struct {
+}
+
+func (s *PidsSubsystem) Name() string {
+	return "pids"
+}
+
+func (s *PidsSubsystem) Set(cgroupPath string, res *resource.ResourceConfig) error {
+	if res.PidsLimit == 0 {
+		return nil
+	}
+	subsystemCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(subsystemCgroupPath, "pids.max"), []byte(pidsLimitString(res.PidsLimit)), constant.Perm0644); err != nil {
+		return fmt.Errorf("set cgroup pids fail %v", err)
+	}
+	return nil
+}
+
+// Apply 即使没有设置 pids 限制也将进程加入 pids cgroup，用于统计容器内的进程数
+func (s *PidsSubsystem) Apply(cgroupPath string, pid int, res *resource.ResourceConfig) error {
+	subsystemCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+	return applyPid(subsystemCgroupPath, pid)
+}
+
+func (s *PidsSubsystem) Remove(cgroupPath string) error {
+	subsystemCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsystemCgroupPath)
+}
+
+func (s *PidsSubsystem) GetStats(cgroupPath string, stats *resource.Stats) error {
+	subsystemCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	if stats.Pids.Current, err = getCgroupParamUint(subsystemCgroupPath, "pids.current"); err != nil {
+		return err
+	}
+	stats.Pids.Limit, err = getCgroupParamUint(subsystemCgroupPath, "pids.max")
+	return err
+}
+
+func pidsLimitString(limit int64) string {
+	if limit < 0 {
+		return "max"
+	}
+	return strconv.FormatInt(limit, 10)
+}
@@ -1 +1,14 @@
-package fs
+package fs2
+
+import "runQ/cgroups/resource"
+
+var SubsystemIns = []resource.Subsystem{
+	&CpusetSubsystem{},
+	&MemorySubsystem{},
+	&CpuSubsystem{},
+	&PidsSubsystem{},
+	&IoSubsystem{},
+	&DevicesSubsystem{},
+	&HugetlbSubsystem{},
+	&FreezerSubsystem{},
+}
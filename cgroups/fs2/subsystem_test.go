@@ -0,0 +1,236 @@
+package fs2
+
+import (
+	"errors"
+	"os"
+	"path"
+	"runQ/cgroups/cgroupstest"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+	"testing"
+)
+
+const testCgroupPath = "runQ/1234567890"
+
+// newFakeCgroupfs 将统一层级的挂载点指向伪造的 cgroupfs，并提前创建容器的 cgroup
+func newFakeCgroupfs(t *testing.T) *cgroupstest.FakeCgroupfs {
+	f := cgroupstest.NewV2(t)
+	old := UnifiedMountpoint
+	UnifiedMountpoint = f.Root
+	t.Cleanup(func() { UnifiedMountpoint = old })
+	f.Create(testCgroupPath)
+	return f
+}
+
+func TestSubsystemSet(t *testing.T) {
+	tests := []struct {
+		name      string
+		subsystem resource.Subsystem
+		res       *resource.ResourceConfig
+		expected  map[string]string
+	}{
+		{
+			name:      "memory",
+			subsystem: &MemorySubsystem{},
+			res:       &resource.ResourceConfig{Memory: 100 << 20, MemorySwap: 300 << 20, MemoryReservation: 50 << 20},
+			expected: map[string]string{
+				"memory.max":      "104857600",
+				"memory.swap.max": "209715200", // v2 中只限制 swap 的用量
+				"memory.low":      "52428800",
+			},
+		},
+		{
+			name:      "memory unlimited swap",
+			subsystem: &MemorySubsystem{},
+			res:       &resource.ResourceConfig{Memory: 100 << 20, MemorySwap: -1},
+			expected:  map[string]string{"memory.max": "104857600", "memory.swap.max": "max"},
+		},
+		{
+			name:      "cpu",
+			subsystem: &CpuSubsystem{},
+			res:       &resource.ResourceConfig{CpuShares: 1024, CpuPeriod: 100000, CpuQuota: 50000},
+			expected:  map[string]string{"cpu.weight": "39", "cpu.max": "50000 100000"},
+		},
+		{
+			name:      "cpu unlimited quota",
+			subsystem: &CpuSubsystem{},
+			res:       &resource.ResourceConfig{CpuQuota: -1},
+			expected:  map[string]string{"cpu.max": "max"},
+		},
+		{
+			name:      "cpuset",
+			subsystem: &CpusetSubsystem{},
+			res:       &resource.ResourceConfig{CpuSet: "1-2", CpusetMems: "0"},
+			expected:  map[string]string{"cpuset.cpus": "1-2", "cpuset.mems": "0"},
+		},
+		{
+			name:      "pids",
+			subsystem: &PidsSubsystem{},
+			res:       &resource.ResourceConfig{PidsLimit: 100},
+			expected:  map[string]string{"pids.max": "100"},
+		},
+		{
+			name:      "io",
+			subsystem: &IoSubsystem{},
+			res: &resource.ResourceConfig{BlkioWeight: 300,
+				BlkioThrottleReadBpsDevice: []*resource.ThrottleDevice{{Major: 8, Minor: 0, Rate: 1 << 20}}},
+			expected: map[string]string{"io.weight": "default 2930", "io.max": "8:0 rbps=1048576"},
+		},
+		{
+			name:      "hugetlb",
+			subsystem: &HugetlbSubsystem{},
+			res:       &resource.ResourceConfig{HugetlbLimit: []*resource.HugepageLimit{{PageSize: "2MB", Limit: 20 << 20}}},
+			expected:  map[string]string{"hugetlb.2MB.max": "20971520"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeCgroupfs(t)
+			if err := tt.subsystem.Set(testCgroupPath, tt.res); err != nil {
+				t.Fatalf("set %s error %v", tt.subsystem.Name(), err)
+			}
+			for file, expected := range tt.expected {
+				if actual := f.ReadFile("", testCgroupPath, file); actual != expected {
+					t.Errorf("%s = %q, expected %q", file, actual, expected)
+				}
+			}
+			// 父 cgroup 中需要开启对应的 controller
+			if enabled := f.ReadFile("", "runQ", subtreeControlFile); enabled != "+"+tt.subsystem.Name() {
+				t.Errorf("%s of parent = %q, expected +%s", subtreeControlFile, enabled, tt.subsystem.Name())
+			}
+		})
+	}
+}
+
+func TestSubsystemSetWithoutLimit(t *testing.T) {
+	f := newFakeCgroupfs(t)
+	for _, subsystem := range SubsystemIns {
+		if err := subsystem.Set("runQ/unlimited", &resource.ResourceConfig{}); err != nil {
+			t.Errorf("set %s error %v", subsystem.Name(), err)
+		}
+	}
+	if f.Exists("", "runQ/unlimited") {
+		t.Error("cgroup should not be created without limits")
+	}
+}
+
+func TestSubsystemApplyAndRemove(t *testing.T) {
+	f := newFakeCgroupfs(t)
+	for _, subsystem := range SubsystemIns {
+		if err := subsystem.Apply(testCgroupPath, 1234, &resource.ResourceConfig{}); err != nil {
+			t.Fatalf("apply %s error %v", subsystem.Name(), err)
+		}
+	}
+	if procs := f.ReadFile("", testCgroupPath, procsFile); procs != "1234" {
+		t.Errorf("%s = %q, expected 1234", procsFile, procs)
+	}
+	for _, subsystem := range SubsystemIns {
+		if err := subsystem.Remove(testCgroupPath); err != nil {
+			t.Fatalf("remove %s error %v", subsystem.Name(), err)
+		}
+	}
+	if f.Exists("", testCgroupPath) {
+		t.Error("cgroup should be removed")
+	}
+}
+
+func TestControllerNotAvailable(t *testing.T) {
+	f := newFakeCgroupfs(t)
+	f.WriteFile("", "", controllersFile, "cpu memory")
+	if err := (&PidsSubsystem{}).Set(testCgroupPath, &resource.ResourceConfig{PidsLimit: 10}); err == nil {
+		t.Error("set unavailable controller should fail")
+	}
+}
+
+// TestFreeze 伪造的 cgroupfs 不会更新 cgroup.events，需要提前写入冻结完成的状态
+func TestFreeze(t *testing.T) {
+	f := newFakeCgroupfs(t)
+	f.WriteFile("", testCgroupPath, eventsFile, "populated 1\nfrozen 1\n")
+	if err := (&FreezerSubsystem{}).Freeze(testCgroupPath, resource.Frozen); err != nil {
+		t.Fatal(err)
+	}
+	if actual := f.ReadFile("", testCgroupPath, freezeFile); actual != "1" {
+		t.Errorf("%s = %q, expected 1", freezeFile, actual)
+	}
+}
+
+func TestOOMKillCount(t *testing.T) {
+	f := newFakeCgroupfs(t)
+	f.WriteFile("", testCgroupPath, memoryEventsFile, "low 0\nhigh 0\nmax 3\noom 2\noom_kill 1\n")
+	count, err := OOMKillCount(testCgroupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("oom kill count = %d, expected 1", count)
+	}
+}
+
+// TestCompileDeviceFilter 所有跳转都必须落在程序范围内，以 root 运行时再交给内核的 verifier 校验
+func TestCompileDeviceFilter(t *testing.T) {
+	rules := append(resource.DefaultDeviceRules, &resource.DeviceRule{Type: resource.DeviceTypeAll, Permissions: "r", Allow: true})
+	insns := compileDeviceFilter(rules)
+	for i, insn := range insns {
+		if target := i + 1 + int(insn.Off); insn.Off != 0 && (target <= i || target >= len(insns)) {
+			t.Fatalf("instruction %d jumps out of range to %d", i, target)
+		}
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("loading eBPF program requires root")
+	}
+	fd, err := loadDeviceFilter(insns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.NewFile(uintptr(fd), "device-filter").Close()
+}
+
+func TestDevicesSetRootless(t *testing.T) {
+	newFakeCgroupfs(t)
+	oldRootless, oldLoader := constant.Rootless, deviceFilterLoader
+	t.Cleanup(func() { constant.Rootless, deviceFilterLoader = oldRootless, oldLoader })
+	constant.Rootless = true
+	loaded := false
+	deviceFilterLoader = func(insns []bpfInsn) (int, error) {
+		loaded = true
+		return -1, os.ErrPermission
+	}
+	res := &resource.ResourceConfig{Devices: resource.DefaultDeviceRules}
+	if err := (&DevicesSubsystem{}).Set(testCgroupPath, res); err != nil {
+		t.Fatal(err)
+	}
+	if loaded {
+		t.Error("device filter should not be loaded in rootless mode")
+	}
+}
+
+// TestCreateCgroupRootless 委派根以上的 cgroup 不可写，只能从委派根开始开启 controller
+func TestCreateCgroupRootless(t *testing.T) {
+	f := newFakeCgroupfs(t)
+	delegated := "user.slice/user@1000.service"
+	cgroupPath := path.Join(delegated, testCgroupPath)
+	f.Create(cgroupPath)
+	f.WriteFile("", "", controllersFile, "cpu")
+	f.WriteFile("", delegated, controllersFile, "memory pids")
+	oldRootless, oldRoot := constant.Rootless, delegatedRoot
+	t.Cleanup(func() { constant.Rootless, delegatedRoot = oldRootless, oldRoot })
+	constant.Rootless = true
+	delegatedRoot = func() (string, error) { return "/" + delegated, nil }
+
+	if err := (&MemorySubsystem{}).Set(cgroupPath, &resource.ResourceConfig{Memory: 100 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	if actual := f.ReadFile("", cgroupPath, "memory.max"); actual != "104857600" {
+		t.Errorf("memory.max = %q, expected 104857600", actual)
+	}
+	if actual := f.ReadFile("", "", subtreeControlFile); actual != "" {
+		t.Errorf("controllers should not be enabled above the delegated cgroup, got %q", actual)
+	}
+	err := (&CpuSubsystem{}).Set(cgroupPath, &resource.ResourceConfig{CpuShares: 512})
+	if !errors.Is(err, ErrControllerNotDelegated) {
+		t.Errorf("set cpu error %v, expected %v", err, ErrControllerNotDelegated)
+	}
+	if err = (&MemorySubsystem{}).Set("runQ/other", &resource.ResourceConfig{Memory: 100 << 20}); err == nil {
+		t.Error("cgroup outside the delegated cgroup should fail")
+	}
+}
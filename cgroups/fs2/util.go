@@ -1 +1,182 @@
-package fs
+package fs2
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"runQ/constant"
+	"strconv"
+	"strings"
+)
+
+// UnifiedMountpoint cgroup v2 统一层级的挂载点，测试时可以替换为临时目录
+var UnifiedMountpoint = "/sys/fs/cgroup"
+
+// ErrControllerNotDelegated rootless 模式下委派的 cgroup 中没有开启的 controller，调用方应跳过对应的 subsystem
+var ErrControllerNotDelegated = errors.New("controller is not delegated")
+
+// delegatedRoot 获取委派给当前用户的 cgroup，测试时可以替换
+var delegatedRoot = DelegatedRoot
+
+const (
+	controllersFile    = "cgroup.controllers"
+	subtreeControlFile = "cgroup.subtree_control"
+	procsFile          = "cgroup.procs"
+)
+
+// getCgroupPath 获取 cgroup v2 下的绝对路径
+// v2 中所有 controller 共用同一个目录，autoCreate 时需要先在各级父 cgroup 的 cgroup.subtree_control 中
+// 开启对应的 controller，子 cgroup 中才会出现 memory.max、cpu.max 等接口文件
+func getCgroupPath(controller, cgroupPath string, autoCreate bool) (string, error) {
+	absPath := path.Join(UnifiedMountpoint, cgroupPath)
+	if !autoCreate {
+		return absPath, nil
+	}
+	if err := createCgroup(controller, cgroupPath); err != nil {
+		return absPath, errors.Wrap(err, "create cgroup")
+	}
+	return absPath, nil
+}
+
+// createCgroup 从根 cgroup 开始逐级创建目录，并在每一级父 cgroup 中开启 controller
+// 比如 cgroupPath 为 runQ/123，则会在 /sys/fs/cgroup 和 /sys/fs/cgroup/runQ 中开启 controller
+// rootless 模式下委派根以上的 cgroup 属于 root，只能从委派根开始向下开启 controller
+func createCgroup(controller, cgroupPath string) error {
+	current, rel := UnifiedMountpoint, path.Clean("/"+cgroupPath)
+	if constant.Rootless {
+		root, err := delegatedRoot()
+		if err != nil {
+			return err
+		}
+		if rel != root && !strings.HasPrefix(rel, root+"/") {
+			return fmt.Errorf("cgroup %s is not under the delegated cgroup %s", cgroupPath, root)
+		}
+		current, rel = path.Join(UnifiedMountpoint, root), strings.TrimPrefix(rel, root)
+	}
+	for _, elem := range strings.Split(strings.Trim(rel, "/"), "/") {
+		if elem == "" {
+			continue
+		}
+		if controller != "" {
+			if err := enableController(current, controller); err != nil {
+				return err
+			}
+		}
+		current = path.Join(current, elem)
+		if err := os.Mkdir(current, constant.Perm0755); err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// enableController 在 dir 的 cgroup.subtree_control 中写入 +controller，已经开启的不再重复写入
+func enableController(dir, controller string) error {
+	available, err := readFields(path.Join(dir, controllersFile))
+	if err != nil {
+		return err
+	}
+	if !contains(available, controller) {
+		if constant.Rootless {
+			return errors.Wrapf(ErrControllerNotDelegated, "%s in %s", controller, dir)
+		}
+		return fmt.Errorf("controller %s is not available in %s", controller, dir)
+	}
+	enabled, err := readFields(path.Join(dir, subtreeControlFile))
+	if err != nil {
+		return err
+	}
+	if contains(enabled, controller) {
+		return nil
+	}
+	if err = os.WriteFile(path.Join(dir, subtreeControlFile), []byte("+"+controller), constant.Perm0644); err != nil {
+		return errors.Wrapf(err, "enable controller %s in %s", controller, dir)
+	}
+	return nil
+}
+
+// applyPid 将进程加入 cgroup，v2 中写入的是 cgroup.procs 而不是 tasks
+func applyPid(cgroupPath string, pid int) error {
+	if err := os.WriteFile(path.Join(cgroupPath, procsFile), []byte(strconv.Itoa(pid)), constant.Perm0644); err != nil {
+		return fmt.Errorf("set cgroup proc fail %v", err)
+	}
+	return nil
+}
+
+func readFields(file string) ([]string, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(content)), nil
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+// getCgroupParamUint 读取 cgroup 接口文件中的单个数值，"max" 表示不限制，返回 0
+func getCgroupParamUint(cgroupPath, file string) (uint64, error) {
+	content, err := os.ReadFile(path.Join(cgroupPath, file))
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// getCgroupParamKeyValue 读取 memory.stat、cpu.stat 这类每行为 "key value" 格式的接口文件
+func getCgroupParamKeyValue(cgroupPath, file string) (map[string]uint64, error) {
+	content, err := os.ReadFile(path.Join(cgroupPath, file))
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]uint64{}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse %s", file)
+		}
+		result[fields[0]] = value
+	}
+	return result, nil
+}
+
+// ProcsFile 容器 cgroup 的 cgroup.procs 文件，v2 中所有 controller 共用同一个 cgroup
+func ProcsFile(cgroupPath string) string {
+	return path.Join(UnifiedMountpoint, cgroupPath, procsFile)
+}
+
+// GetPids 获取 cgroup 中的所有进程
+func GetPids(cgroupPath string) ([]int, error) {
+	subsystemCgroupPath, err := getCgroupPath("", cgroupPath, false)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := readFields(path.Join(subsystemCgroupPath, procsFile))
+	if err != nil {
+		return nil, err
+	}
+	pids := make([]int, 0, len(fields))
+	for _, field := range fields {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("parse pid %s fail %v", field, err)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
@@ -0,0 +1,59 @@
+package resource
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxCpuListIndex cpuset 列表中允许的最大编号，内核的 NR_CPUS 最大为 8192，NUMA 节点数更少
+// 展开范围之前需要检查，否则 0-2000000000 这样的输入会在校验之前占用大量内存
+const maxCpuListIndex = 8191
+
+// ParseCpuList 解析 cpuset 格式的列表，e.g. "0-3,5" -> {0,1,2,3,5}
+// cpuset.cpus 和 cpuset.mems 使用相同的格式
+func ParseCpuList(list string) (map[int]bool, error) {
+	result := map[int]bool{}
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return result, nil
+	}
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid cpuset list %s", list)
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(bounds[1]); err != nil || end < start {
+				return nil, fmt.Errorf("invalid cpuset list %s", list)
+			}
+		}
+		if end > maxCpuListIndex {
+			return nil, fmt.Errorf("invalid cpuset list %s, index must not be greater than %d", list, maxCpuListIndex)
+		}
+		for i := start; i <= end; i++ {
+			result[i] = true
+		}
+	}
+	return result, nil
+}
+
+// CheckCpuListSubset 检查 list 中的每一项是否都包含在 available 中，available 通常为父 cgroup 的 effective cpus/mems
+func CheckCpuListSubset(list, available string) error {
+	requested, err := ParseCpuList(list)
+	if err != nil {
+		return err
+	}
+	allowed, err := ParseCpuList(available)
+	if err != nil {
+		return err
+	}
+	for i := range requested {
+		if !allowed[i] {
+			return fmt.Errorf("requested %s is not available, available: %s", list, strings.TrimSpace(available))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package resource
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"runQ/utils"
+	"strconv"
+	"strings"
+)
+
+// WeightDevice 块设备的 IO 权重，e.g. --blkio-weight-device /dev/sda:200
+type WeightDevice struct {
+	Major  int64  `json:"major"`
+	Minor  int64  `json:"minor"`
+	Weight uint16 `json:"weight"`
+}
+
+func (d *WeightDevice) String() string {
+	return fmt.Sprintf("%d:%d %d", d.Major, d.Minor, d.Weight)
+}
+
+// ThrottleDevice 块设备的读写速率限制，Rate 的单位为 bytes/s 或 io/s
+type ThrottleDevice struct {
+	Major int64  `json:"major"`
+	Minor int64  `json:"minor"`
+	Rate  uint64 `json:"rate"`
+}
+
+func (d *ThrottleDevice) String() string {
+	return fmt.Sprintf("%d:%d %d", d.Major, d.Minor, d.Rate)
+}
+
+const (
+	BlkioWeightMin = 10
+	BlkioWeightMax = 1000
+)
+
+// ParseWeightDevice 解析 /dev/sda:200 格式的设备权重
+func ParseWeightDevice(val string) (*WeightDevice, error) {
+	devicePath, value, err := splitDeviceValue(val)
+	if err != nil {
+		return nil, err
+	}
+	weight, err := strconv.ParseUint(value, 10, 16)
+	if err != nil || weight < BlkioWeightMin || weight > BlkioWeightMax {
+		return nil, fmt.Errorf("invalid weight for device %s: %s, must be in range [%d, %d]", devicePath, value, BlkioWeightMin, BlkioWeightMax)
+	}
+	major, minor, err := deviceNumber(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	return &WeightDevice{Major: major, Minor: minor, Weight: uint16(weight)}, nil
+}
+
+// ParseThrottleBpsDevice 解析 /dev/sda:10mb 格式的设备读写速率限制
+func ParseThrottleBpsDevice(val string) (*ThrottleDevice, error) {
+	devicePath, value, err := splitDeviceValue(val)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := utils.RAMInBytes(value)
+	if err != nil || rate <= 0 {
+		return nil, fmt.Errorf("invalid rate for device %s: %s, must be a positive size like 10mb", devicePath, value)
+	}
+	return newThrottleDevice(devicePath, uint64(rate))
+}
+
+// ParseThrottleIOpsDevice 解析 /dev/sda:1000 格式的设备 iops 限制
+func ParseThrottleIOpsDevice(val string) (*ThrottleDevice, error) {
+	devicePath, value, err := splitDeviceValue(val)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || rate == 0 {
+		return nil, fmt.Errorf("invalid iops for device %s: %s, must be a positive integer", devicePath, value)
+	}
+	return newThrottleDevice(devicePath, rate)
+}
+
+func newThrottleDevice(devicePath string, rate uint64) (*ThrottleDevice, error) {
+	major, minor, err := deviceNumber(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	return &ThrottleDevice{Major: major, Minor: minor, Rate: rate}, nil
+}
+
+func splitDeviceValue(val string) (string, string, error) {
+	idx := strings.LastIndex(val, ":")
+	if idx <= 0 || idx == len(val)-1 {
+		return "", "", fmt.Errorf("invalid device option [%s], must be <device-path>:<value>", val)
+	}
+	if !strings.HasPrefix(val, "/dev/") {
+		return "", "", fmt.Errorf("invalid device path [%s], must start with /dev/", val[:idx])
+	}
+	return val[:idx], val[idx+1:], nil
+}
+
+// deviceNumber 通过 stat 获取块设备的主次设备号
+func deviceNumber(devicePath string) (int64, int64, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(devicePath, &stat); err != nil {
+		return 0, 0, fmt.Errorf("stat device %s error %v", devicePath, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return 0, 0, fmt.Errorf("%s is not a block device", devicePath)
+	}
+	return int64(unix.Major(stat.Rdev)), int64(unix.Minor(stat.Rdev)), nil
+}
@@ -0,0 +1,96 @@
+package resource
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 设备类型，与 devices.allow 中的写法一致
+const (
+	DeviceTypeAll   = "a"
+	DeviceTypeChar  = "c"
+	DeviceTypeBlock = "b"
+)
+
+// DeviceWildcard 表示任意主/次设备号，即 devices.allow 中的 *
+const DeviceWildcard int64 = -1
+
+// DeviceRule 设备访问规则，e.g. c 1:3 rwm
+type DeviceRule struct {
+	Type        string `json:"type"`
+	Major       int64  `json:"major"`
+	Minor       int64  `json:"minor"`
+	Permissions string `json:"permissions"` // r 读，w 写，m mknod
+	Allow       bool   `json:"allow"`
+}
+
+// String 生成写入 devices.allow/devices.deny 的内容
+func (r *DeviceRule) String() string {
+	if r.Type == DeviceTypeAll {
+		return "a"
+	}
+	return fmt.Sprintf("%s %s:%s %s", r.Type, deviceNumberString(r.Major), deviceNumberString(r.Minor), r.Permissions)
+}
+
+func deviceNumberString(number int64) string {
+	if number == DeviceWildcard {
+		return "*"
+	}
+	return strconv.FormatInt(number, 10)
+}
+
+// DefaultDeviceRules 容器默认允许访问的设备，其余设备一律禁止
+var DefaultDeviceRules = []*DeviceRule{
+	// 允许 mknod 创建任意设备节点，能否读写仍由下面的规则决定
+	{Type: DeviceTypeChar, Major: DeviceWildcard, Minor: DeviceWildcard, Permissions: "m", Allow: true},
+	{Type: DeviceTypeBlock, Major: DeviceWildcard, Minor: DeviceWildcard, Permissions: "m", Allow: true},
+	{Type: DeviceTypeChar, Major: 1, Minor: 3, Permissions: "rwm", Allow: true},                // /dev/null
+	{Type: DeviceTypeChar, Major: 1, Minor: 5, Permissions: "rwm", Allow: true},                // /dev/zero
+	{Type: DeviceTypeChar, Major: 1, Minor: 7, Permissions: "rwm", Allow: true},                // /dev/full
+	{Type: DeviceTypeChar, Major: 1, Minor: 8, Permissions: "rwm", Allow: true},                // /dev/random
+	{Type: DeviceTypeChar, Major: 1, Minor: 9, Permissions: "rwm", Allow: true},                // /dev/urandom
+	{Type: DeviceTypeChar, Major: 5, Minor: 0, Permissions: "rwm", Allow: true},                // /dev/tty
+	{Type: DeviceTypeChar, Major: 5, Minor: 2, Permissions: "rwm", Allow: true},                // /dev/ptmx
+	{Type: DeviceTypeChar, Major: 136, Minor: DeviceWildcard, Permissions: "rwm", Allow: true}, // /dev/pts/*
+}
+
+// AllowAllDevices 允许访问所有设备，用于特权容器
+var AllowAllDevices = &DeviceRule{Type: DeviceTypeAll, Major: DeviceWildcard, Minor: DeviceWildcard, Permissions: "rwm", Allow: true}
+
+// ParseDeviceCgroupRule 解析 --device-cgroup-rule 的规则，格式与 devices.allow 相同，e.g. 'c 1:3 rwm'、'b 8:* r'
+func ParseDeviceCgroupRule(val string) (*DeviceRule, error) {
+	fields := strings.Fields(val)
+	if len(fields) == 1 && fields[0] == DeviceTypeAll {
+		return &DeviceRule{Type: DeviceTypeAll, Major: DeviceWildcard, Minor: DeviceWildcard, Permissions: "rwm", Allow: true}, nil
+	}
+	if len(fields) != 3 || (fields[0] != DeviceTypeChar && fields[0] != DeviceTypeBlock && fields[0] != DeviceTypeAll) {
+		return nil, fmt.Errorf("invalid device cgroup rule %s, must be like 'c 1:3 rwm'", val)
+	}
+	rule := &DeviceRule{Type: fields[0], Allow: true}
+	numbers := strings.Split(fields[1], ":")
+	if len(numbers) != 2 {
+		return nil, fmt.Errorf("invalid device number %s in device cgroup rule %s", fields[1], val)
+	}
+	var err error
+	if rule.Major, err = parseDeviceNumber(numbers[0]); err != nil {
+		return nil, fmt.Errorf("invalid major number in device cgroup rule %s", val)
+	}
+	if rule.Minor, err = parseDeviceNumber(numbers[1]); err != nil {
+		return nil, fmt.Errorf("invalid minor number in device cgroup rule %s", val)
+	}
+	for _, p := range fields[2] {
+		if p != 'r' && p != 'w' && p != 'm' || strings.Count(fields[2], string(p)) > 1 {
+			return nil, fmt.Errorf("invalid permissions %s in device cgroup rule %s, must be combination of rwm", fields[2], val)
+		}
+	}
+	rule.Permissions = fields[2]
+	return rule, nil
+}
+
+func parseDeviceNumber(val string) (int64, error) {
+	if val == "*" {
+		return DeviceWildcard, nil
+	}
+	return strconv.ParseInt(val, 10, 64)
+}
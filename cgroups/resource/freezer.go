@@ -0,0 +1,14 @@
+package resource
+
+// FreezerState 冻结状态，取值与 v1 freezer.state 中的内容一致
+type FreezerState string
+
+const (
+	Frozen FreezerState = "FROZEN"
+	Thawed FreezerState = "THAWED"
+)
+
+// Freezer 支持冻结/解冻 cgroup 中所有进程的 subsystem 实现该接口
+type Freezer interface {
+	Freeze(path string, state FreezerState) error
+}
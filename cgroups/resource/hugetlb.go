@@ -0,0 +1,84 @@
+package resource
+
+import (
+	"fmt"
+	"os"
+	"runQ/utils"
+	"strconv"
+	"strings"
+)
+
+// hugePagesDir 宿主机支持的大页大小，每种大小对应一个 hugepages-{size}kB 目录
+const hugePagesDir = "/sys/kernel/mm/hugepages"
+
+// HugepageLimit 某一种大页的使用上限
+type HugepageLimit struct {
+	PageSize string `json:"pageSize"` // cgroup 接口文件中使用的大页大小，e.g. 2MB、1GB
+	Limit    uint64 `json:"limit"`    // 上限，单位字节
+}
+
+// ParseHugepageLimit 解析 --hugepages 2MB:100，表示最多使用 100 个 2MB 的大页
+func ParseHugepageLimit(val string) (*HugepageLimit, error) {
+	sizeStr, pagesStr, ok := strings.Cut(val, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid hugepages %s, must be like 2MB:100", val)
+	}
+	size, err := utils.RAMInBytes(sizeStr)
+	if err != nil || size <= 0 {
+		return nil, fmt.Errorf("invalid hugepage size %s", sizeStr)
+	}
+	pages, err := strconv.ParseUint(pagesStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hugepage count %s", pagesStr)
+	}
+	pageSize := HugePageSizeName(uint64(size))
+	supported, err := GetHugePageSizes()
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(supported, pageSize) {
+		return nil, fmt.Errorf("hugepage size %s is not supported, supported sizes: %s", pageSize, strings.Join(supported, ","))
+	}
+	return &HugepageLimit{PageSize: pageSize, Limit: pages * uint64(size)}, nil
+}
+
+// GetHugePageSizes 获取宿主机支持的大页大小，e.g. [2MB 1GB]
+func GetHugePageSizes() ([]string, error) {
+	entries, err := os.ReadDir(hugePagesDir)
+	if err != nil {
+		return nil, fmt.Errorf("read %s error: %v, hugetlb may be not supported", hugePagesDir, err)
+	}
+	var sizes []string
+	for _, entry := range entries {
+		kb, ok := strings.CutSuffix(strings.TrimPrefix(entry.Name(), "hugepages-"), "kB")
+		if !ok {
+			continue
+		}
+		size, err := strconv.ParseUint(kb, 10, 64)
+		if err != nil {
+			continue
+		}
+		sizes = append(sizes, HugePageSizeName(size*utils.KiB))
+	}
+	return sizes, nil
+}
+
+// HugePageSizeName 将大页大小转换为 cgroup 接口文件中的写法，e.g. 2097152 -> 2MB，对应 hugetlb.2MB.limit_in_bytes
+func HugePageSizeName(size uint64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	i := 0
+	for size >= 1024 && size%1024 == 0 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	return fmt.Sprintf("%d%s", size, units[i])
+}
+
+func containsString(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,58 @@
 package resource
 
 type ResourceConfig struct {
-	MemoryLimit string
-	CpuCfsQuota int
-	CpuShare    string
-	CpuSet      string
+	// 内存限制，单位均为字节，在解析命令行参数时就已经从 100m 这样的字符串换算好
+	Memory            int64   // 内存上限，-1 表示不限制
+	MemorySwap        int64   // 内存 + swap 的总上限，-1 表示不限制 swap
+	MemoryReservation int64   // 内存软限制，v2 中对应 memory.low
+	MemorySwappiness  *uint64 // [0-100]，nil 表示使用系统默认值
+	OomKillDisable    bool    // 内存超限时不触发 OOM killer
+	KernelMemory      int64   // 内核内存上限，仅 v1 支持
+	KernelMemoryTCP   int64   // TCP buffer 内存上限，仅 v1 支持
+
+	CpuShares  uint64 // CPU 相对权重，v1 写入 cpu.shares，v2 换算后写入 cpu.weight
+	CpuPeriod  uint64 // CFS 调度周期，单位微秒
+	CpuQuota   int64  // 每个周期内可使用的 CPU 时间，单位微秒，-1 表示不限制
+	CpuSet     string // 允许使用的 CPU，e.g. 0-2,4
+	CpusetMems string // 允许使用的内存节点(NUMA)，e.g. 0,1
+	PidsLimit  int64  // 容器内最大进程数，-1 表示不限制
+
+	// 块设备 IO 限制，v1 对应 blkio subsystem，v2 对应 io controller
+	BlkioWeight                  uint16            // 默认 IO 权重 [10-1000]
+	BlkioWeightDevice            []*WeightDevice   // 单个设备的 IO 权重
+	BlkioThrottleReadBpsDevice   []*ThrottleDevice // 设备读速率限制 bytes/s
+	BlkioThrottleWriteBpsDevice  []*ThrottleDevice // 设备写速率限制 bytes/s
+	BlkioThrottleReadIOPSDevice  []*ThrottleDevice // 设备读 iops 限制
+	BlkioThrottleWriteIOPSDevice []*ThrottleDevice // 设备写 iops 限制
+
+	Devices      []*DeviceRule    // 设备访问规则，为空时不做限制
+	HugetlbLimit []*HugepageLimit // 大页使用上限
+}
+
+// HasMemoryLimit 是否设置了内存相关的限制
+func (r *ResourceConfig) HasMemoryLimit() bool {
+	return r.Memory != 0 || r.MemorySwap != 0 || r.MemoryReservation != 0 || r.MemorySwappiness != nil ||
+		r.OomKillDisable || r.KernelMemory != 0 || r.KernelMemoryTCP != 0
+}
+
+// HasCpuLimit 是否设置了 CPU 相关的限制
+func (r *ResourceConfig) HasCpuLimit() bool {
+	return r.CpuShares != 0 || r.CpuPeriod != 0 || r.CpuQuota != 0
+}
+
+// HasCpusetLimit 是否设置了 cpuset 限制
+func (r *ResourceConfig) HasCpusetLimit() bool {
+	return r.CpuSet != "" || r.CpusetMems != ""
+}
+
+// HasBlkioLimit 是否设置了任意一项块设备 IO 限制
+func (r *ResourceConfig) HasBlkioLimit() bool {
+	return r.BlkioWeight != 0 || len(r.BlkioWeightDevice) > 0 ||
+		len(r.BlkioThrottleReadBpsDevice) > 0 || len(r.BlkioThrottleWriteBpsDevice) > 0 ||
+		len(r.BlkioThrottleReadIOPSDevice) > 0 || len(r.BlkioThrottleWriteIOPSDevice) > 0
+}
+
+// HasHugetlbLimit 是否设置了大页限制
+func (r *ResourceConfig) HasHugetlbLimit() bool {
+	return len(r.HugetlbLimit) > 0
 }
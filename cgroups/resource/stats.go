@@ -0,0 +1,50 @@
+package resource
+
+// Stats 从容器 cgroup 中读取到的资源使用情况
+type Stats struct {
+	Cpu    CpuStats    `json:"cpu"`
+	Memory MemoryStats `json:"memory"`
+	Pids   PidsStats   `json:"pids"`
+	Blkio  BlkioStats  `json:"blkio"`
+	Cpuset CpusetStats `json:"cpuset"`
+}
+
+type CpuStats struct {
+	UsageTotal uint64 `json:"usage_total"` // 累计使用的 CPU 时间，单位纳秒
+}
+
+type MemoryStats struct {
+	Usage uint64 `json:"usage"` // 不包含 inactive_file 缓存的内存用量
+	Limit uint64 `json:"limit"` // 0 表示不限制
+}
+
+type PidsStats struct {
+	Current uint64 `json:"current"`
+	Limit   uint64 `json:"limit"` // 0 表示不限制
+}
+
+type BlkioStats struct {
+	ReadBytes  uint64              `json:"read_bytes"`
+	WriteBytes uint64              `json:"write_bytes"`
+	Devices    []*BlkioDeviceStats `json:"devices,omitempty"`
+}
+
+type BlkioDeviceStats struct {
+	Major      uint64 `json:"major"`
+	Minor      uint64 `json:"minor"`
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+}
+
+// Add 累加一个设备的读写字节数
+func (s *BlkioStats) Add(device *BlkioDeviceStats) {
+	s.ReadBytes += device.ReadBytes
+	s.WriteBytes += device.WriteBytes
+	s.Devices = append(s.Devices, device)
+}
+
+// CpusetStats 容器实际可以使用的 CPU 和内存节点
+type CpusetStats struct {
+	EffectiveCpus string `json:"effective_cpus"`
+	EffectiveMems string `json:"effective_mems"`
+}
@@ -9,3 +9,8 @@ type Subsystem interface {
 
 	Remove(path string) error
 }
+
+// StatsGetter 支持统计资源使用情况的 subsystem 实现该接口
+type StatsGetter interface {
+	GetStats(path string, stats *Stats) error
+}
@@ -0,0 +1,92 @@
+package resource
+
+import (
+	"fmt"
+	"runtime"
+)
+
+const (
+	// DefaultCpuPeriod 默认的 CFS 调度周期 100ms
+	DefaultCpuPeriod = 100000
+
+	cpuPeriodMin = 1000    // 1ms
+	cpuPeriodMax = 1000000 // 1s
+	cpuQuotaMin  = 1000
+	cpuSharesMin = 2
+	cpuSharesMax = 262144
+
+	// MinMemory 容器内存上限的最小值，太小的内存连容器的 init 进程都无法启动
+	MinMemory = 6 * 1024 * 1024
+)
+
+// Validate 在写入 cgroup 之前检查资源限制是否合法
+func (r *ResourceConfig) Validate() error {
+	if err := r.validateMemory(); err != nil {
+		return err
+	}
+	if err := r.validateCpu(); err != nil {
+		return err
+	}
+	return r.validateCpuset()
+}
+
+// validateCpuset 只检查格式，是否在父 cgroup 的 effective 范围内需要在写入 cgroup 时检查
+func (r *ResourceConfig) validateCpuset() error {
+	if _, err := ParseCpuList(r.CpuSet); err != nil {
+		return err
+	}
+	_, err := ParseCpuList(r.CpusetMems)
+	return err
+}
+
+func (r *ResourceConfig) validateMemory() error {
+	if r.Memory > 0 && r.Memory < MinMemory {
+		return fmt.Errorf("minimum memory limit allowed is 6MB")
+	}
+	if r.Memory < -1 || r.MemorySwap < -1 || r.MemoryReservation < 0 || r.KernelMemory < -1 || r.KernelMemoryTCP < -1 {
+		return fmt.Errorf("memory limits can not be negative, except -1 for unlimited")
+	}
+	if r.MemorySwap != 0 {
+		// memory-swap 是内存和 swap 的总和，必须同时设置内存上限
+		if r.Memory <= 0 {
+			return fmt.Errorf("you should always set the memory limit when using memory swap limit")
+		}
+		if r.MemorySwap > 0 && r.MemorySwap < r.Memory {
+			return fmt.Errorf("minimum memory swap limit should be larger than memory limit")
+		}
+	}
+	if r.MemoryReservation > 0 && r.Memory > 0 && r.MemoryReservation > r.Memory {
+		return fmt.Errorf("minimum memory limit can not be less than memory reservation limit")
+	}
+	if r.MemorySwappiness != nil && *r.MemorySwappiness > 100 {
+		return fmt.Errorf("invalid memory swappiness %d, must be in range [0, 100]", *r.MemorySwappiness)
+	}
+	if r.KernelMemory > 0 && r.KernelMemory < MinMemory {
+		return fmt.Errorf("minimum kernel memory limit allowed is 6MB")
+	}
+	return nil
+}
+
+func (r *ResourceConfig) validateCpu() error {
+	if r.CpuShares != 0 && (r.CpuShares < cpuSharesMin || r.CpuShares > cpuSharesMax) {
+		return fmt.Errorf("invalid cpu shares %d, must be in range [%d, %d]", r.CpuShares, cpuSharesMin, cpuSharesMax)
+	}
+	if r.CpuPeriod != 0 && (r.CpuPeriod < cpuPeriodMin || r.CpuPeriod > cpuPeriodMax) {
+		return fmt.Errorf("invalid cpu period %d, must be in range [%d, %d]", r.CpuPeriod, cpuPeriodMin, cpuPeriodMax)
+	}
+	if r.CpuQuota == 0 || r.CpuQuota == -1 {
+		return nil
+	}
+	if r.CpuQuota < cpuQuotaMin {
+		return fmt.Errorf("invalid cpu quota %d, must be -1 or not less than %d", r.CpuQuota, cpuQuotaMin)
+	}
+	period := r.CpuPeriod
+	if period == 0 {
+		period = DefaultCpuPeriod
+	}
+	// quota/period 即容器可以使用的 CPU 个数，不能超过宿主机的 CPU 数量
+	if cpus := float64(r.CpuQuota) / float64(period); cpus > float64(runtime.NumCPU()) {
+		return fmt.Errorf("requested %.2f cpus, but only %d cpus available on the host", cpus, runtime.NumCPU())
+	}
+	return nil
+}
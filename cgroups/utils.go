@@ -0,0 +1,23 @@
+package cgroups
+
+import (
+	"os"
+	"path"
+	"runQ/cgroups/fs2"
+	"sync"
+)
+
+var (
+	isUnifiedOnce sync.Once
+	isUnified     bool
+)
+
+// IsCgroup2UnifiedMode 判断宿主机是否使用 cgroup v2 统一层级
+// v2 的挂载点下会有 cgroup.controllers 文件，v1 (包括 hybrid 模式) 下则没有
+func IsCgroup2UnifiedMode() bool {
+	isUnifiedOnce.Do(func() {
+		_, err := os.Stat(path.Join(fs2.UnifiedMountpoint, "cgroup.controllers"))
+		isUnified = err == nil
+	})
+	return isUnified
+}
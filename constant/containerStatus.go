@@ -1,12 +1,17 @@
 package constant
 
 const (
-	RUNNING       = "running"
-	STOP          = "stopped"
-	EXIT          = "exited"
-	InfoLoc       = "/var/lib/runQ/containers/"
-	InfoLocFormat = InfoLoc + "%s/"
-	ConfigName    = "config.json"
-	IDLength      = 10
-	LogFile       = "%s-json.log"
+	RUNNING    = "running"
+	STOP       = "stopped"
+	EXIT       = "exited"
+	PAUSED     = "paused"
+	ConfigName = "config.json"
+	IDLength   = 10
+	LogFile    = "%s-json.log"
+)
+
+// 容器退出的原因
+const (
+	ExitReasonExited    = "Exited"
+	ExitReasonOOMKilled = "OOMKilled"
 )
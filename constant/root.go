@@ -0,0 +1,37 @@
+package constant
+
+import "path"
+
+// DefaultStateRoot root 用户运行时保存镜像、overlay 目录、容器信息和网络配置的根目录
+const DefaultStateRoot = "/var/lib/runQ"
+
+// EnvRootless 子进程(monitor 等)通过该环境变量继承 rootless 模式
+const EnvRootless = "RUNQ_ROOTLESS"
+
+// 以下路径都跟随 StateRoot，rootless 模式下 StateRoot 为 $XDG_RUNTIME_DIR/runQ
+var (
+	StateRoot     string
+	InfoLoc       string
+	InfoLocFormat string
+	EventsLog     string
+	// Rootless 是否以普通用户运行，rootless 模式下不能挂载宿主机上的文件系统，也不能创建网络设备
+	Rootless bool
+)
+
+func init() {
+	SetStateRoot(DefaultStateRoot)
+}
+
+// SetStateRoot 切换状态目录，需要在读写任何容器信息之前调用
+func SetStateRoot(root string) {
+	StateRoot = root
+	InfoLoc = path.Join(root, "containers") + "/"
+	InfoLocFormat = InfoLoc + "%s/"
+	EventsLog = path.Join(root, "events.log")
+}
+
+// SetupRootless 进入 rootless 模式，状态保存在 runtimeDir/runQ 下
+func SetupRootless(runtimeDir string) {
+	Rootless = true
+	SetStateRoot(path.Join(runtimeDir, "runQ"))
+}
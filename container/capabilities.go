@@ -0,0 +1,230 @@
+package container
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const capLastCapFile = "/proc/sys/kernel/cap_last_cap"
+
+// capabilityNames 内核支持的 capability，名称与 capabilities(7) 一致
+var capabilityNames = map[string]uintptr{
+	"CAP_CHOWN":              unix.CAP_CHOWN,
+	"CAP_DAC_OVERRIDE":       unix.CAP_DAC_OVERRIDE,
+	"CAP_DAC_READ_SEARCH":    unix.CAP_DAC_READ_SEARCH,
+	"CAP_FOWNER":             unix.CAP_FOWNER,
+	"CAP_FSETID":             unix.CAP_FSETID,
+	"CAP_KILL":               unix.CAP_KILL,
+	"CAP_SETGID":             unix.CAP_SETGID,
+	"CAP_SETUID":             unix.CAP_SETUID,
+	"CAP_SETPCAP":            unix.CAP_SETPCAP,
+	"CAP_LINUX_IMMUTABLE":    unix.CAP_LINUX_IMMUTABLE,
+	"CAP_NET_BIND_SERVICE":   unix.CAP_NET_BIND_SERVICE,
+	"CAP_NET_BROADCAST":      unix.CAP_NET_BROADCAST,
+	"CAP_NET_ADMIN":          unix.CAP_NET_ADMIN,
+	"CAP_NET_RAW":            unix.CAP_NET_RAW,
+	"CAP_IPC_LOCK":           unix.CAP_IPC_LOCK,
+	"CAP_IPC_OWNER":          unix.CAP_IPC_OWNER,
+	"CAP_SYS_MODULE":         unix.CAP_SYS_MODULE,
+	"CAP_SYS_RAWIO":          unix.CAP_SYS_RAWIO,
+	"CAP_SYS_CHROOT":         unix.CAP_SYS_CHROOT,
+	"CAP_SYS_PTRACE":         unix.CAP_SYS_PTRACE,
+	"CAP_SYS_PACCT":          unix.CAP_SYS_PACCT,
+	"CAP_SYS_ADMIN":          unix.CAP_SYS_ADMIN,
+	"CAP_SYS_BOOT":           unix.CAP_SYS_BOOT,
+	"CAP_SYS_NICE":           unix.CAP_SYS_NICE,
+	"CAP_SYS_RESOURCE":       unix.CAP_SYS_RESOURCE,
+	"CAP_SYS_TIME":           unix.CAP_SYS_TIME,
+	"CAP_SYS_TTY_CONFIG":     unix.CAP_SYS_TTY_CONFIG,
+	"CAP_MKNOD":              unix.CAP_MKNOD,
+	"CAP_LEASE":              unix.CAP_LEASE,
+	"CAP_AUDIT_WRITE":        unix.CAP_AUDIT_WRITE,
+	"CAP_AUDIT_CONTROL":      unix.CAP_AUDIT_CONTROL,
+	"CAP_SETFCAP":            unix.CAP_SETFCAP,
+	"CAP_MAC_OVERRIDE":       unix.CAP_MAC_OVERRIDE,
+	"CAP_MAC_ADMIN":          unix.CAP_MAC_ADMIN,
+	"CAP_SYSLOG":             unix.CAP_SYSLOG,
+	"CAP_WAKE_ALARM":         unix.CAP_WAKE_ALARM,
+	"CAP_BLOCK_SUSPEND":      unix.CAP_BLOCK_SUSPEND,
+	"CAP_AUDIT_READ":         unix.CAP_AUDIT_READ,
+	"CAP_PERFMON":            unix.CAP_PERFMON,
+	"CAP_BPF":                unix.CAP_BPF,
+	"CAP_CHECKPOINT_RESTORE": unix.CAP_CHECKPOINT_RESTORE,
+}
+
+// DefaultCapabilities 容器默认保留的 capability，与 docker 的默认值一致
+var DefaultCapabilities = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FSETID",
+	"CAP_FOWNER",
+	"CAP_MKNOD",
+	"CAP_NET_RAW",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETFCAP",
+	"CAP_SETPCAP",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_SYS_CHROOT",
+	"CAP_KILL",
+	"CAP_AUDIT_WRITE",
+}
+
+// normalizeCapability 统一 capability 的写法，--cap-add 中可以省略 CAP_ 前缀，不区分大小写，e.g. net_admin
+func normalizeCapability(name string) (string, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "ALL" {
+		return name, nil
+	}
+	if !strings.HasPrefix(name, "CAP_") {
+		name = "CAP_" + name
+	}
+	if _, ok := capabilityNames[name]; !ok {
+		return "", fmt.Errorf("unknown capability %s", name)
+	}
+	return name, nil
+}
+
+// AllCapabilities 当前进程 bounding set 中的所有 capability，runQ 本身被限制时(e.g. 运行在容器中)不能给容器更多的 capability
+func AllCapabilities() []string {
+	lastCap := lastCapability()
+	var caps []string
+	for name, value := range capabilityNames {
+		if value > lastCap {
+			continue
+		}
+		if ok, err := unix.PrctlRetInt(unix.PR_CAPBSET_READ, value, 0, 0, 0); err == nil && ok == 1 {
+			caps = append(caps, name)
+		}
+	}
+	sort.Slice(caps, func(i, j int) bool {
+		return capabilityNames[caps[i]] < capabilityNames[caps[j]]
+	})
+	return caps
+}
+
+// TweakCapabilities 在默认的 capability 上增加和删除，ALL 表示所有 capability，先处理 drop 再处理 add
+// e.g. --cap-drop ALL --cap-add NET_BIND_SERVICE 只保留 CAP_NET_BIND_SERVICE
+func TweakCapabilities(add, drop []string, privileged bool) ([]string, error) {
+	if privileged {
+		return AllCapabilities(), nil
+	}
+	capSet := map[string]bool{}
+	for _, name := range DefaultCapabilities {
+		capSet[name] = true
+	}
+	for _, val := range drop {
+		name, err := normalizeCapability(val)
+		if err != nil {
+			return nil, err
+		}
+		if name == "ALL" {
+			capSet = map[string]bool{}
+			continue
+		}
+		delete(capSet, name)
+	}
+	for _, val := range add {
+		name, err := normalizeCapability(val)
+		if err != nil {
+			return nil, err
+		}
+		if name == "ALL" {
+			for _, c := range AllCapabilities() {
+				capSet[c] = true
+			}
+			continue
+		}
+		capSet[name] = true
+	}
+	caps := make([]string, 0, len(capSet))
+	for name := range capSet {
+		caps = append(caps, name)
+	}
+	sort.Slice(caps, func(i, j int) bool {
+		return capabilityNames[caps[i]] < capabilityNames[caps[j]]
+	})
+	return caps, nil
+}
+
+// lastCapability 读取内核支持的最大 capability，旧内核不支持的 capability 不能写入
+func lastCapability() uintptr {
+	content, err := os.ReadFile(capLastCapFile)
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	last, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 32)
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	return uintptr(last)
+}
+
+// prepareCapabilities 收缩 bounding set 并设置 keepcaps，names 为 nil 时不修改 capability
+// setuid 切换到非 root 用户时内核会清空 permitted 集合，设置 keepcaps 后才能在切换用户后继续 capset
+func prepareCapabilities(names []string) (map[uintptr]bool, error) {
+	if names == nil {
+		return nil, nil
+	}
+	caps, err := capabilitySet(names)
+	if err != nil {
+		return nil, err
+	}
+	if err = dropBoundingSet(caps); err != nil {
+		return nil, err
+	}
+	if err = unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+		return nil, errors.Wrap(err, "set keepcaps")
+	}
+	return caps, nil
+}
+
+// dropBoundingSet 从 bounding set 中删除不在 caps 中的 capability，之后 execve 的程序(包括 setuid 程序)也无法再获得这些 capability
+func dropBoundingSet(caps map[uintptr]bool) error {
+	for c := uintptr(0); c <= lastCapability(); c++ {
+		if caps[c] {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, c, 0, 0, 0); err != nil {
+			return errors.Wrapf(err, "drop capability %d from bounding set", c)
+		}
+	}
+	return nil
+}
+
+// setCapabilities 设置当前线程的 effective、permitted、inheritable 集合
+func setCapabilities(caps map[uintptr]bool) error {
+	header := &unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	data := [2]unix.CapUserData{}
+	for c := range caps {
+		mask := uint32(1) << (c % 32)
+		data[c/32].Effective |= mask
+		data[c/32].Permitted |= mask
+		data[c/32].Inheritable |= mask
+	}
+	if err := unix.Capset(header, &data[0]); err != nil {
+		return errors.Wrap(err, "capset")
+	}
+	return nil
+}
+
+// capabilitySet 将 capability 名称转换为编号
+func capabilitySet(names []string) (map[uintptr]bool, error) {
+	caps := map[uintptr]bool{}
+	lastCap := lastCapability()
+	for _, name := range names {
+		value, ok := capabilityNames[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown capability %s", name)
+		}
+		if value <= lastCap {
+			caps[value] = true
+		}
+	}
+	return caps, nil
+}
@@ -0,0 +1,33 @@
+package container
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTweakCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		add     []string
+		drop    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "drop", drop: []string{"cap_chown", "MKNOD", "NET_RAW", "SETFCAP", "SETPCAP", "NET_BIND_SERVICE", "SYS_CHROOT", "AUDIT_WRITE"},
+			want: []string{"CAP_DAC_OVERRIDE", "CAP_FOWNER", "CAP_FSETID", "CAP_KILL", "CAP_SETGID", "CAP_SETUID"}},
+		// 先 drop 再 add
+		{name: "drop all", add: []string{"net_admin", "KILL"}, drop: []string{"ALL"}, want: []string{"CAP_KILL", "CAP_NET_ADMIN"}},
+		{name: "unknown", add: []string{"FOO"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			caps, err := TweakCapabilities(test.add, test.drop, false)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("TweakCapabilities() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(caps, test.want) {
+				t.Errorf("TweakCapabilities() = %v, expected %v", caps, test.want)
+			}
+		})
+	}
+}
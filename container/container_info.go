@@ -9,7 +9,10 @@ import (
 	"math/rand"
 	"os"
 	"path"
+	"runQ/cgroups"
+	"runQ/cgroups/resource"
 	"runQ/constant"
+	"runQ/seccomp"
 	"strconv"
 	"strings"
 	"syscall"
@@ -18,17 +21,36 @@ import (
 )
 
 type ContainerInfo struct {
-	Pid         string   `json:"pid"` // 容器的init进程在宿主机上的 PID
-	Id          string   `json:"id"`
-	Name        string   `json:"name"`
-	Command     string   `json:"command"`
-	CreateTime  string   `json:"create_time"`
-	Status      string   `json:"status"`
-	Volume      string   `json:"volume"`
-	PortMapping []string `json:"portmapping"`
-	NetworkName string   `json:"networkName"`
+	Pid          string                   `json:"pid"` // 容器的init进程在宿主机上的 PID
+	Id           string                   `json:"id"`
+	Name         string                   `json:"name"`
+	Command      string                   `json:"command"`
+	CreateTime   string                   `json:"create_time"`
+	Status       string                   `json:"status"`
+	Volume       string                   `json:"volume"`
+	PortMapping  []string                 `json:"portmapping"`
+	NetworkName  string                   `json:"networkName"`
+	CgroupPath   string                   `json:"cgroupPath"` // 容器的 cgroup 路径，e.g. runQ/{containerId}
+	Resource     *resource.ResourceConfig `json:"resource,omitempty"`
+	OOMKilled    bool                     `json:"oomKilled"`            // 容器运行期间是否发生过 OOM kill
+	ExitReason   string                   `json:"exitReason,omitempty"` // 容器退出的原因，e.g. OOMKilled
+	FinishedAt   string                   `json:"finishedAt,omitempty"`
+	Privileged   bool                     `json:"privileged,omitempty"`
+	Capabilities []string                 `json:"capabilities"`      // 容器进程保留的 capability
+	Seccomp      string                   `json:"seccomp,omitempty"` // seccomp profile，default、unconfined 或者 profile 的路径
+	// SeccompProgram run 时编译好的过滤程序，exec 时直接使用，profile 文件之后被修改或删除也不影响
+	SeccompProgram seccomp.Program `json:"seccompProgram,omitempty"`
+	UidMappings    []IDMap         `json:"uidMappings,omitempty"` // user namespace 的映射，exec 时需要进入同一个 user namespace
+	GidMappings    []IDMap         `json:"gidMappings,omitempty"`
+	Namespaces     *Namespaces     `json:"namespaces,omitempty"` // pid、ipc 等 namespace 的模式，其他容器共享 namespace 时需要检查
 }
 
+const (
+	// stopTimeout 发送 SIGTERM 后等待容器退出的时间，超时后发送 SIGKILL
+	stopTimeout       = 10 * time.Second
+	stopCheckInterval = 100 * time.Millisecond
+)
+
 func randStringBytes(n int) string {
 	letterBytes := "1234567890"
 	rand.Seed(time.Now().UnixNano())
@@ -39,22 +61,33 @@ func randStringBytes(n int) string {
 	return string(b)
 }
 
-func RecordContainerInfo(containerPID int, commandArray []string, containerName, containerId, volume, networkName string, portMapping []string) (*ContainerInfo, error) {
+func RecordContainerInfo(containerPID int, commandArray []string, containerName, containerId, volume, networkName string, portMapping []string,
+	cgroupPath string, res *resource.ResourceConfig, privileged bool, capabilities []string, seccompProfile string, seccompProgram seccomp.Program, uidMaps, gidMaps []IDMap,
+	namespaces *Namespaces) (*ContainerInfo, error) {
 	if containerName == "" {
 		containerName = containerId
 	}
-	command := strings.Join(commandArray, "")
+	command := strings.Join(commandArray, " ")
 
 	containerInfo := &ContainerInfo{
-		Id:          containerId,
-		Pid:         strconv.Itoa(containerPID),
-		Command:     command,
-		CreateTime:  time.Now().Format(time.RFC3339),
-		Status:      constant.RUNNING,
-		Name:        containerName,
-		Volume:      volume,
-		NetworkName: networkName,
-		PortMapping: portMapping,
+		Id:             containerId,
+		Pid:            strconv.Itoa(containerPID),
+		Command:        command,
+		CreateTime:     time.Now().Format(time.RFC3339),
+		Status:         constant.RUNNING,
+		Name:           containerName,
+		Volume:         volume,
+		NetworkName:    networkName,
+		PortMapping:    portMapping,
+		CgroupPath:     cgroupPath,
+		Resource:       res,
+		Privileged:     privileged,
+		Capabilities:   capabilities,
+		Seccomp:        seccompProfile,
+		SeccompProgram: seccompProgram,
+		UidMappings:    uidMaps,
+		GidMappings:    gidMaps,
+		Namespaces:     namespaces,
 	}
 	JsonBytes, err := json.Marshal(containerInfo)
 	if err != nil {
@@ -62,13 +95,13 @@ func RecordContainerInfo(containerPID int, commandArray []string, containerName,
 	}
 	jsonStr := string(JsonBytes)
 	dirPath := fmt.Sprintf(constant.InfoLocFormat, containerInfo.Id)
-	if err := os.MkdirAll(dirPath, constant.Perm0622); err != nil {
+	if err := os.MkdirAll(dirPath, constant.Perm0755); err != nil {
 		return containerInfo, errors.WithMessagef(err, "mkdir %s failed", dirPath)
 	}
 	fileName := path.Join(dirPath, constant.ConfigName)
 	file, err := os.Create(fileName)
 	if err != nil {
-		return containerInfo, errors.WithMessagef(err, "create file %S failed", fileName)
+		return containerInfo, errors.WithMessagef(err, "create file %s failed", fileName)
 	}
 	defer file.Close()
 
@@ -100,11 +133,15 @@ func PrintListContainers() {
 		log.Errorf("Fprint error %v", err)
 	}
 	for _, item := range containers {
+		status := item.Status
+		if item.OOMKilled {
+			status = fmt.Sprintf("%s (%s)", status, constant.ExitReasonOOMKilled)
+		}
 		_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
 			item.Id,
 			item.Name,
 			item.Pid,
-			item.Status,
+			status,
 			item.Command,
 			item.CreateTime)
 		if err != nil {
@@ -141,12 +178,12 @@ func getContainerInfo(containerFile os.DirEntry) (*ContainerInfo, error) {
 	configFileDir = path.Join(configFileDir, constant.ConfigName)
 	content, err := os.ReadFile(configFileDir)
 	if err != nil {
-		log.Errorf("read container config file error %V", configFileDir, err)
+		log.Errorf("read container config file %s error %v", configFileDir, err)
 		return nil, err
 	}
 	containerInfo := new(ContainerInfo)
 	if err := json.Unmarshal(content, containerInfo); err != nil {
-		log.Errorf("json unmarshal error %V", err)
+		log.Errorf("json unmarshal error %v", err)
 		return nil, err
 	}
 	return containerInfo, nil
@@ -192,20 +229,41 @@ func StopContainer(containerName string) {
 		log.Errorf("Stop container %s error %v", containerId, err)
 		return
 	}
+	// 被冻结的进程无法处理信号，发送信号后需要解冻，信号会在解冻后送达
+	if containerInfo.Status == constant.PAUSED {
+		if err = freezeContainer(containerInfo, resource.Thawed); err != nil {
+			log.Errorf("Unpause container %s error %v", containerId, err)
+			return
+		}
+	}
+	// 3.等待容器进程真正退出后再清理 cgroup，否则 cgroup 中还有进程时无法删除
+	if !waitForExit(containerPidInt, stopTimeout) {
+		log.Warnf("Container %s did not exit in %v, kill it", containerId, stopTimeout)
+		_ = syscall.Kill(containerPidInt, syscall.SIGKILL)
+		waitForExit(containerPidInt, stopTimeout)
+	}
+	destroyCgroup(containerInfo)
 	containerInfo.Status = constant.STOP
 	containerInfo.Pid = " "
+	if err = UpdateContainerInfo(containerInfo); err != nil {
+		log.Errorf("Update container %s info error %v", containerId, err)
+		return
+	}
+	RecordEvent(EventStop, containerInfo, nil)
+}
+
+// UpdateContainerInfo 将容器信息重新写回配置文件
+func UpdateContainerInfo(containerInfo *ContainerInfo) error {
 	newContentBytes, err := json.Marshal(containerInfo)
-	fmt.Println("newContentBytes>", newContentBytes)
 	if err != nil {
-		log.Errorf("Json maeshal %s error %v", containerId, err)
-		return
+		return errors.WithMessagef(err, "json marshal %s", containerInfo.Id)
 	}
-	// 重新写回
-	dirPath := fmt.Sprintf(constant.InfoLocFormat, containerId)
+	dirPath := fmt.Sprintf(constant.InfoLocFormat, containerInfo.Id)
 	configFilePath := path.Join(dirPath, constant.ConfigName)
-	if err := os.WriteFile(configFilePath, newContentBytes, constant.Perm0622); err != nil {
-		log.Errorf("Write file %s error: %v", configFilePath, err)
+	if err = os.WriteFile(configFilePath, newContentBytes, constant.Perm0622); err != nil {
+		return errors.Wrapf(err, "write file %s", configFilePath)
 	}
+	return nil
 }
 
 func getContainerInfoByContainerId(containerId string) (*ContainerInfo, error) {
@@ -234,7 +292,7 @@ func RemoveContainer(containerName string, force bool) {
 		return
 	}
 	switch containerInfo.Status {
-	case constant.STOP:
+	case constant.STOP, constant.EXIT:
 		// 先删除配置目录，再删除rootfs 目录
 		if err = DeleteContainerInfo(containerId); err != nil {
 			log.Errorf("Remove container [%s]'s config failed,detail: %v", containerId, err)
@@ -242,10 +300,12 @@ func RemoveContainer(containerName string, force bool) {
 		}
 		fmt.Println("containerInfo.Volume>", containerInfo.Volume)
 		DeleteWorkSpace(containerId, containerInfo.Volume)
-	case constant.RUNNING:
+		destroyCgroup(containerInfo)
+		RecordEvent(EventDestroy, containerInfo, nil)
+	case constant.RUNNING, constant.PAUSED:
 		if !force {
-			log.Errorf("Couldn't remove running container[%s], stop the container beforce attempting removal or"+
-				"force remove", containerId)
+			log.Errorf("Couldn't remove %s container[%s], stop the container beforce attempting removal or"+
+				"force remove", containerInfo.Status, containerId)
 			return
 		}
 		StopContainer(containerId)
@@ -260,9 +320,39 @@ func GetLogfile(containerId string) string {
 	return fmt.Sprintf(constant.LogFile, containerId)
 }
 
+// GetContainerInfoByName 根据容器名(或容器ID)获取容器信息
+func GetContainerInfoByName(containerName string) (*ContainerInfo, error) {
+	containerId := GetContainerIdByName(containerName)
+	if containerId == "" {
+		return nil, fmt.Errorf("no such container: %s", containerName)
+	}
+	return getContainerInfoByContainerId(containerId)
+}
+
+// waitForExit 轮询检查进程是否已经退出，超时返回 false
+func waitForExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+			return true
+		}
+		time.Sleep(stopCheckInterval)
+	}
+	return false
+}
+
+// destroyCgroup 删除容器的 cgroup，需要在容器进程退出之后调用
+func destroyCgroup(containerInfo *ContainerInfo) {
+	if containerInfo.CgroupPath == "" {
+		return
+	}
+	_ = cgroups.NewCgroupManager(containerInfo.CgroupPath).Destroy()
+}
+
 func GetContainerIdByName(containerName string) string {
 	for _, container := range ListContainers() {
-		if container.Name == containerName {
+		// RemoveContainer 等内部调用会直接传入容器ID，这里同时支持按ID匹配
+		if container.Name == containerName || container.Id == containerName {
 			return container.Id
 		}
 	}
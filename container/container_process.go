@@ -19,20 +19,31 @@ import (
 3.下面的clone参数就是去fork出来一个新进程，并且使用了namespace隔离新创建的进程和外部环境。
 4.如果用户指定了-it参数，就需要把当前进程的输入输出导入到标准输入输出上
 */
-func NewParentProcess(tty bool, volume, containerId, imageName string, envSlice []string) (*exec.Cmd, *os.File) {
+func NewParentProcess(tty bool, volume, containerId, imageName string, uidMaps, gidMaps []IDMap, namespaces *Namespaces) (*exec.Cmd, *os.File, *os.File) {
 	// 创建匿名管道用于传递参数，将readPipe作为子进程的ExtraFiles，子进程从readPipe中读取参数
-	// 父进程中则通过writePipe将参数写入管道
+	// 父进程中则通过writePipe将 InitConfig 写入管道
 	readPipe, writePipe, err := os.Pipe()
 	if err != nil {
 		log.Errorf("New pipe error %v", err)
-		return nil, nil
+		return nil, nil, nil
 	}
 	cmd := exec.Command(constant.EXECSELF, "init")
 	// cmd -> /proc/self/exe init /bin/sh
 	// /proc/self/exe表示当前进程的可执行文件 也就是runQ
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS |
-			syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC,
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: namespaces.cloneFlags()}
+	// time namespace 的偏移只能在进程级别写入，需要在 Go 运行时启动之前由 nsenter 设置
+	if len(namespaces.TimeOffsets) > 0 {
+		cmd.Env = append(os.Environ(), EnvTimensOffsets+"="+namespaces.timensOffsets())
+	}
+	// 使用 user namespace 时容器中的 root 映射为宿主机上的普通用户，init 进程需要 setgroups 切换用户
+	if len(uidMaps) > 0 {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = toSysProcIDMaps(uidMaps)
+		cmd.SysProcAttr.GidMappings = toSysProcIDMaps(gidMaps)
+		// 普通用户只有禁用 setgroups 之后才能写入 gid_map
+		cmd.SysProcAttr.GidMappingsEnableSetgroups = !constant.Rootless
+		// 子进程在宿主机上是 root，在新的 user namespace 中没有映射，需要切换为 namespace 中的 root，否则 execve 后会失去所有 capability
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: 0, Gid: 0}
 	}
 	if tty {
 		cmd.Stdin = os.Stdin
@@ -42,24 +53,45 @@ func NewParentProcess(tty bool, volume, containerId, imageName string, envSlice
 		//dirPath := fmt.Sprintf(constant.InfoLocFormat,containerId)
 		//if err := os.MkdirAll()
 		dirPath := fmt.Sprintf(constant.InfoLocFormat, containerId)
-		if err = os.MkdirAll(dirPath, constant.Perm0622); err != nil {
+		if err = os.MkdirAll(dirPath, constant.Perm0755); err != nil {
 			log.Errorf("NewParentProcess mkdir %s error %v", dirPath, err)
-			return nil, nil
+			return nil, nil, nil
 		}
 		stdLogFilePath := dirPath + GetLogfile(containerId)
 		stdLogFile, err := os.Create(stdLogFilePath)
 		if err != nil {
 			log.Errorf("NewParentProcess create file %s error %v", stdLogFilePath, err)
-			return nil, nil
+			return nil, nil, nil
 		}
 		cmd.Stdout = stdLogFile
 		cmd.Stderr = stdLogFile
 	}
-	cmd.ExtraFiles = []*os.File{readPipe}
+	// 子进程通过 syncWritePipe 报告初始化结果，父进程从 syncReadPipe 中读取
+	syncReadPipe, syncWritePipe, err := os.Pipe()
+	if err != nil {
+		log.Errorf("New sync pipe error %v", err)
+		return nil, nil, nil
+	}
+	cmd.ExtraFiles = []*os.File{readPipe, syncWritePipe}
 	// cmd.Dir 并不是用于挂载目录的。
 	// 它设置了子进程的工作目录，即子进程在执行时的当前目录。
-	NewWorkSpace(containerId, imageName, volume)
+	if err = NewWorkSpace(containerId, imageName, volume, uidMaps, gidMaps); err != nil {
+		log.Errorf("New workspace error %v", err)
+		return nil, nil, nil
+	}
 	cmd.Dir = utils.GetMerged(containerId)
-	cmd.Env = append(os.Environ(), envSlice...)
-	return cmd, writePipe
+	return cmd, writePipe, syncReadPipe
+}
+
+// StartParentProcess 启动子进程后关闭父进程中子进程那一端的管道，否则子进程退出后父进程也读不到 EOF
+// 共享其他容器的 pid、ipc namespace 时需要在加入这些 namespace 的线程上启动子进程
+func StartParentProcess(cmd *exec.Cmd, namespaces *Namespaces) error {
+	paths, err := namespaces.joinPaths()
+	if err == nil {
+		err = startInNamespaces(cmd, paths)
+	}
+	for _, file := range cmd.ExtraFiles {
+		_ = file.Close()
+	}
+	return err
 }
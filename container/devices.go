@@ -0,0 +1,161 @@
+package container
+
+import (
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runQ/constant"
+	"strconv"
+	"syscall"
+)
+
+// DefaultShmSize /dev/shm 的默认大小，与 docker 一致为 64M
+const DefaultShmSize = 64 * 1024 * 1024
+
+// Device 需要在容器 /dev 中创建的设备文件
+type Device struct {
+	Path     string      `json:"path"` // 容器内的路径，e.g. /dev/null
+	Type     uint32      `json:"type"` // syscall.S_IFCHR 或者 syscall.S_IFBLK
+	Major    uint32      `json:"major"`
+	Minor    uint32      `json:"minor"`
+	FileMode os.FileMode `json:"fileMode"`
+}
+
+// DefaultDevices 容器中默认创建的设备，与 cgroup 的默认设备白名单 resource.DefaultDeviceRules 对应
+var DefaultDevices = []*Device{
+	{Path: "/dev/null", Type: syscall.S_IFCHR, Major: 1, Minor: 3, FileMode: 0666},
+	{Path: "/dev/zero", Type: syscall.S_IFCHR, Major: 1, Minor: 5, FileMode: 0666},
+	{Path: "/dev/full", Type: syscall.S_IFCHR, Major: 1, Minor: 7, FileMode: 0666},
+	{Path: "/dev/random", Type: syscall.S_IFCHR, Major: 1, Minor: 8, FileMode: 0666},
+	{Path: "/dev/urandom", Type: syscall.S_IFCHR, Major: 1, Minor: 9, FileMode: 0666},
+	{Path: "/dev/tty", Type: syscall.S_IFCHR, Major: 5, Minor: 0, FileMode: 0666},
+}
+
+// hostDevicesSkipped 特权容器不从宿主机复制的设备和目录，由容器自己的挂载点提供，console 对应宿主机的控制台
+var hostDevicesSkipped = map[string]bool{
+	"/dev/pts":     true,
+	"/dev/shm":     true,
+	"/dev/mqueue":  true,
+	"/dev/console": true,
+}
+
+// devSymlinks /dev 下的标准软链接，link -> target
+var devSymlinks = [][2]string{
+	{"/dev/fd", "/proc/self/fd"},
+	{"/dev/stdin", "/proc/self/fd/0"},
+	{"/dev/stdout", "/proc/self/fd/1"},
+	{"/dev/stderr", "/proc/self/fd/2"},
+	{"/dev/ptmx", "pts/ptmx"},
+}
+
+// DefaultMounts 容器默认的挂载点，需要按顺序挂载，/dev 下的挂载点依赖 /dev 的 tmpfs
+func DefaultMounts(shmSize int64) []*Mount {
+	if shmSize <= 0 {
+		shmSize = DefaultShmSize
+	}
+	defaultMountFlags := syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
+	// rootless 模式下 user namespace 中只映射了 root，tty 组(gid 5)不存在，指定 gid 会导致挂载失败
+	ptsData := "newinstance,ptmxmode=0666,mode=0620,gid=5"
+	if constant.Rootless {
+		ptsData = "newinstance,ptmxmode=0666,mode=0620"
+	}
+	return []*Mount{
+		{Source: "proc", Destination: "/proc", Device: "proc", Flags: defaultMountFlags},
+		// tmpfs 是基于内存的文件系统，使用 RAM、swap 分区来存储。
+		// 不挂载 /dev，会导致容器内部无法访问和使用许多设备，这可能导致系统无法正常工作
+		{Source: "tmpfs", Destination: "/dev", Device: "tmpfs", Flags: syscall.MS_NOSUID | syscall.MS_STRICTATIME, Data: "mode=755"},
+		// newinstance 使容器拥有独立的 pty 编号，不会看到宿主机的 pty
+		{Source: "devpts", Destination: "/dev/pts", Device: "devpts", Flags: syscall.MS_NOSUID | syscall.MS_NOEXEC,
+			Data: ptsData},
+		{Source: "shm", Destination: "/dev/shm", Device: "tmpfs", Flags: defaultMountFlags,
+			Data: "mode=1777,size=" + strconv.FormatInt(shmSize, 10)},
+		{Source: "mqueue", Destination: "/dev/mqueue", Device: "mqueue", Flags: defaultMountFlags},
+		// 容器内不能修改 /sys，只读挂载
+		{Source: "sysfs", Destination: "/sys", Device: "sysfs", Flags: defaultMountFlags | syscall.MS_RDONLY},
+	}
+}
+
+// HostDevices 特权容器中创建的设备，除了 DefaultDevices 之外还有宿主机 /dev 下的所有设备
+func HostDevices() ([]*Device, error) {
+	devices := append([]*Device{}, DefaultDevices...)
+	created := map[string]bool{}
+	for _, device := range DefaultDevices {
+		created[device.Path] = true
+	}
+	err := filepath.WalkDir("/dev", func(p string, d fs.DirEntry, err error) error {
+		// 无法读取的子目录跳过
+		if err != nil {
+			if p == "/dev" {
+				return err
+			}
+			return nil
+		}
+		if hostDevicesSkipped[p] {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&os.ModeDevice == 0 || created[p] {
+			return nil
+		}
+		var stat unix.Stat_t
+		if err = unix.Lstat(p, &stat); err != nil {
+			return nil
+		}
+		devices = append(devices, &Device{
+			Path:     p,
+			Type:     stat.Mode & unix.S_IFMT,
+			Major:    unix.Major(stat.Rdev),
+			Minor:    unix.Minor(stat.Rdev),
+			FileMode: os.FileMode(stat.Mode & 0777),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "read host devices")
+	}
+	return devices, nil
+}
+
+// setupDev 在 rootfs 的 /dev 中创建设备文件和软链接，需要在 pivot_root 之前执行，mknod 失败时还能 bind mount 宿主机的设备
+func setupDev(rootfs string, devices []*Device) error {
+	for _, device := range devices {
+		if err := createDevice(rootfs, device); err != nil {
+			return err
+		}
+	}
+	for _, link := range devSymlinks {
+		dest := filepath.Join(rootfs, link[0])
+		// /dev/ptmx 可能已经作为设备文件存在，需要替换为指向 devpts 的软链接
+		if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "remove %s", link[0])
+		}
+		if err := os.Symlink(link[1], dest); err != nil {
+			return errors.Wrapf(err, "symlink %s to %s", link[0], link[1])
+		}
+	}
+	return nil
+}
+
+func createDevice(rootfs string, device *Device) error {
+	dest := filepath.Join(rootfs, device.Path)
+	if err := os.MkdirAll(filepath.Dir(dest), constant.Perm0755); err != nil {
+		return err
+	}
+	dev := unix.Mkdev(device.Major, device.Minor)
+	err := unix.Mknod(dest, device.Type|uint32(device.FileMode.Perm()), int(dev))
+	if err == nil {
+		// mknod 创建的文件权限会受 umask 影响
+		return os.Chmod(dest, device.FileMode.Perm())
+	}
+	if !errors.Is(err, syscall.EPERM) {
+		return errors.Wrapf(err, "mknod %s", device.Path)
+	}
+	// 没有 CAP_MKNOD 时(e.g. user namespace 中)只能 bind mount 宿主机上的设备
+	log.Infof("Mknod %s not permitted, bind mount it from host", device.Path)
+	return mountToRootfs(rootfs, &Mount{Source: device.Path, Destination: device.Path, Device: "bind", Flags: syscall.MS_BIND})
+}
@@ -3,12 +3,28 @@ package container
 import (
 	log "github.com/sirupsen/logrus"
 	"os"
+	"runQ/seccomp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 const (
 	EnvExecPid       = "runQ_pid"
 	EnvExecCmd       = "runQ_cmd"
 	EnvExecContainer = "runQ_containerName"
+	// exec 指定用户时传递给 nsenter 的用户信息
+	EnvExecUid    = "runQ_uid"
+	EnvExecGid    = "runQ_gid"
+	EnvExecGroups = "runQ_groups"
+	EnvExecHome   = "runQ_home"
+	// exec 进程保留的 capability 编号(以逗号分隔)和 seccomp 过滤程序，由 nsenter 在 system() 之前设置
+	EnvExecCaps    = "runQ_caps"
+	EnvExecSeccomp = "runQ_seccomp"
+	// EnvExecCgroupProcs exec 进程需要加入的 cgroup.procs 文件，以冒号分隔，由 nsenter 在进入 namespace 之前写入自己的 pid
+	EnvExecCgroupProcs = "runQ_cgroup_procs"
+	// EnvTimensOffsets init 进程的 time namespace 中时钟的偏移，由 nsenter 在 Go 运行时启动之前写入
+	EnvTimensOffsets = "runQ_timens_offsets"
 )
 
 func setContainerENV() {
@@ -21,3 +37,40 @@ func SetExecENV(pid string, cmdStr string) {
 	_ = os.Setenv(EnvExecCmd, cmdStr)
 	log.Infof("Exec Env setup Successfully with Pid: %s command: %s", pid, cmdStr)
 }
+
+// SetExecUserENV 设置 exec 进程的用户，nsenter 进入容器的 namespace 之后切换到该用户
+func SetExecUserENV(user *ExecUser) {
+	groups := make([]string, 0, len(user.Sgids))
+	for _, gid := range user.Sgids {
+		groups = append(groups, strconv.Itoa(gid))
+	}
+	_ = os.Setenv(EnvExecUid, strconv.Itoa(user.Uid))
+	_ = os.Setenv(EnvExecGid, strconv.Itoa(user.Gid))
+	_ = os.Setenv(EnvExecGroups, strings.Join(groups, ","))
+	_ = os.Setenv(EnvExecHome, user.Home)
+}
+
+// SetExecSecurityENV 设置 exec 进程与容器 init 进程相同的 capability 和 seccomp 过滤程序
+// caps 为 nil 时不修改 capability，空列表表示删除所有 capability
+func SetExecSecurityENV(caps []string, program seccomp.Program) error {
+	if caps != nil {
+		set, err := capabilitySet(caps)
+		if err != nil {
+			return err
+		}
+		values := make([]int, 0, len(set))
+		for c := range set {
+			values = append(values, int(c))
+		}
+		sort.Ints(values)
+		numbers := make([]string, 0, len(values))
+		for _, c := range values {
+			numbers = append(numbers, strconv.Itoa(c))
+		}
+		_ = os.Setenv(EnvExecCaps, strings.Join(numbers, ","))
+	}
+	if len(program) > 0 {
+		_ = os.Setenv(EnvExecSeccomp, program.Hex())
+	}
+	return nil
+}
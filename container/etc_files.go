@@ -0,0 +1,187 @@
+package container
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"os"
+	"path"
+	"runQ/constant"
+	"strings"
+	"syscall"
+)
+
+// 容器状态目录中生成的文件，bind mount 到容器的 /etc 下
+const (
+	hostnameFile   = "hostname"
+	hostsFile      = "hosts"
+	resolvConfFile = "resolv.conf"
+)
+
+// resolvConfPaths 宿主机上的 resolv.conf，systemd-resolved 的 /etc/resolv.conf 中只有 127.0.0.53，需要读取上游的配置
+var resolvConfPaths = []string{"/etc/resolv.conf", "/run/systemd/resolve/resolv.conf"}
+
+// defaultNameservers 宿主机上只有本地 DNS 时使用的 nameserver，容器的 network namespace 中访问不到宿主机的 loopback
+var defaultNameservers = []string{"8.8.8.8", "8.8.4.4"}
+
+// EtcFilesConfig 生成容器的 /etc/hostname、/etc/hosts、/etc/resolv.conf 的配置
+type EtcFilesConfig struct {
+	Hostname   string
+	Domainname string
+	IP         string   // 容器连接网络后分配的 IP，为空时 hosts 中不添加容器自己的记录
+	ExtraHosts []string // --add-host 添加的记录，格式为 host:ip
+	DNS        []string // 不为空时替换宿主机的 nameserver
+	DNSSearch  []string
+	DNSOptions []string
+}
+
+// ParseExtraHost 解析 --add-host，格式为 host:ip，IPv6 地址中也有冒号，只按第一个冒号分割
+func ParseExtraHost(val string) (host, ip string, err error) {
+	host, ip, ok := strings.Cut(val, ":")
+	if !ok || host == "" {
+		return "", "", fmt.Errorf("invalid add-host %s, must be host:ip", val)
+	}
+	if net.ParseIP(ip) == nil {
+		return "", "", fmt.Errorf("invalid add-host %s, %s is not a valid ip", val, ip)
+	}
+	return host, ip, nil
+}
+
+// SetupEtcFiles 在容器的状态目录中生成 hostname、hosts、resolv.conf，返回需要 bind mount 到容器中的挂载点
+// 文件随容器信息一起删除
+func SetupEtcFiles(containerId string, config *EtcFilesConfig) ([]*Mount, error) {
+	resolvConf, err := hostResolvConf()
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{
+		hostnameFile:   config.Hostname + "\n",
+		hostsFile:      buildHosts(config),
+		resolvConfFile: buildResolvConf(resolvConf, config),
+	}
+	dirPath := fmt.Sprintf(constant.InfoLocFormat, containerId)
+	var mounts []*Mount
+	for _, name := range []string{hostnameFile, hostsFile, resolvConfFile} {
+		filePath := path.Join(dirPath, name)
+		if err = os.WriteFile(filePath, []byte(files[name]), constant.Perm0644); err != nil {
+			return nil, errors.Wrapf(err, "write %s", filePath)
+		}
+		mounts = append(mounts, &Mount{Source: filePath, Destination: path.Join("/etc", name), Device: "bind",
+			Flags: syscall.MS_BIND})
+	}
+	return mounts, nil
+}
+
+func buildHosts(config *EtcFilesConfig) string {
+	var b strings.Builder
+	b.WriteString("127.0.0.1\tlocalhost\n")
+	b.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+	b.WriteString("fe00::0\tip6-localnet\n")
+	b.WriteString("ff00::0\tip6-mcastprefix\n")
+	b.WriteString("ff02::1\tip6-allnodes\n")
+	b.WriteString("ff02::2\tip6-allrouters\n")
+	for _, extraHost := range config.ExtraHosts {
+		if host, ip, err := ParseExtraHost(extraHost); err == nil {
+			_, _ = fmt.Fprintf(&b, "%s\t%s\n", ip, host)
+		}
+	}
+	if config.IP != "" {
+		names := config.Hostname
+		if config.Domainname != "" {
+			names = config.Hostname + "." + config.Domainname + " " + config.Hostname
+		}
+		_, _ = fmt.Fprintf(&b, "%s\t%s\n", config.IP, names)
+	}
+	return b.String()
+}
+
+// resolvConf resolv.conf 中容器需要的配置
+type resolvConf struct {
+	nameservers []string
+	search      []string
+	options     []string
+}
+
+func parseResolvConf(content string) *resolvConf {
+	conf := &resolvConf{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			conf.nameservers = append(conf.nameservers, fields[1])
+		case "search", "domain":
+			// search 和 domain 都存在时以最后一个为准
+			conf.search = fields[1:]
+		case "options":
+			conf.options = append(conf.options, fields[1:]...)
+		}
+	}
+	return conf
+}
+
+// hostResolvConf 读取宿主机的 DNS 配置，去掉容器中访问不到的本地 nameserver
+func hostResolvConf() (*resolvConf, error) {
+	var conf *resolvConf
+	for _, p := range resolvConfPaths {
+		content, err := os.ReadFile(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "read %s", p)
+		}
+		parsed := parseResolvConf(string(content))
+		parsed.nameservers = filterLocalNameservers(parsed.nameservers)
+		if conf == nil {
+			conf = parsed
+		}
+		if len(parsed.nameservers) > 0 {
+			conf.nameservers = parsed.nameservers
+			return conf, nil
+		}
+	}
+	if conf == nil {
+		conf = &resolvConf{}
+	}
+	conf.nameservers = defaultNameservers
+	return conf, nil
+}
+
+func filterLocalNameservers(nameservers []string) []string {
+	var filtered []string
+	for _, ns := range nameservers {
+		if ip := net.ParseIP(ns); ip != nil && ip.IsLoopback() {
+			continue
+		}
+		filtered = append(filtered, ns)
+	}
+	return filtered
+}
+
+// buildResolvConf --dns、--dns-search、--dns-option 分别替换宿主机上对应的配置
+func buildResolvConf(host *resolvConf, config *EtcFilesConfig) string {
+	conf := *host
+	if len(config.DNS) > 0 {
+		conf.nameservers = config.DNS
+	}
+	if len(config.DNSSearch) > 0 {
+		conf.search = config.DNSSearch
+	}
+	if len(config.DNSOptions) > 0 {
+		conf.options = config.DNSOptions
+	}
+	var b strings.Builder
+	if len(conf.search) > 0 {
+		_, _ = fmt.Fprintf(&b, "search %s\n", strings.Join(conf.search, " "))
+	}
+	for _, ns := range conf.nameservers {
+		_, _ = fmt.Fprintf(&b, "nameserver %s\n", ns)
+	}
+	if len(conf.options) > 0 {
+		_, _ = fmt.Fprintf(&b, "options %s\n", strings.Join(conf.options, " "))
+	}
+	return b.String()
+}
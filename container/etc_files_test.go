@@ -0,0 +1,63 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHostResolvConf(t *testing.T) {
+	dir := t.TempDir()
+	stub := filepath.Join(dir, "resolv.conf")
+	upstream := filepath.Join(dir, "upstream.conf")
+	if err := os.WriteFile(stub, []byte("# stub\nnameserver 127.0.0.53\nsearch lan\noptions edns0 trust-ad\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(upstream, []byte("nameserver 10.0.0.1\nnameserver ::1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := resolvConfPaths
+	t.Cleanup(func() { resolvConfPaths = old })
+
+	// 本地的 nameserver 被过滤掉，使用上游的配置，search 和 options 仍然使用 /etc/resolv.conf 中的
+	resolvConfPaths = []string{stub, upstream}
+	conf, err := hostResolvConf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &resolvConf{nameservers: []string{"10.0.0.1"}, search: []string{"lan"}, options: []string{"edns0", "trust-ad"}}
+	if !reflect.DeepEqual(conf, expected) {
+		t.Errorf("hostResolvConf() = %+v, expected %+v", conf, expected)
+	}
+
+	resolvConfPaths = []string{stub}
+	if conf, err = hostResolvConf(); err != nil || !reflect.DeepEqual(conf.nameservers, defaultNameservers) {
+		t.Errorf("hostResolvConf() = %+v, %v, expected default nameservers", conf, err)
+	}
+
+	got := buildResolvConf(expected, &EtcFilesConfig{DNS: []string{"1.1.1.1"}, DNSOptions: []string{"ndots:2"}})
+	if got != "search lan\nnameserver 1.1.1.1\noptions ndots:2\n" {
+		t.Errorf("buildResolvConf() = %q", got)
+	}
+}
+
+func TestBuildHosts(t *testing.T) {
+	hosts := buildHosts(&EtcFilesConfig{
+		Hostname:   "web",
+		Domainname: "example.com",
+		IP:         "192.168.0.2",
+		ExtraHosts: []string{"db:10.0.0.2", "v6:fe80::1"},
+	})
+	for _, line := range []string{"127.0.0.1\tlocalhost\n", "10.0.0.2\tdb\n", "fe80::1\tv6\n", "192.168.0.2\tweb.example.com web\n"} {
+		if !strings.Contains(hosts, line) {
+			t.Errorf("hosts does not contain %q:\n%s", line, hosts)
+		}
+	}
+	for _, val := range []string{"db", ":10.0.0.2", "db:10.0.0"} {
+		if _, _, err := ParseExtraHost(val); err == nil {
+			t.Errorf("ParseExtraHost(%s) expected error", val)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package container
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path"
+	"runQ/constant"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 容器事件类型
+const (
+	EventStart   = "start"
+	EventOOM     = "oom"
+	EventDie     = "die"
+	EventStop    = "stop"
+	EventDestroy = "destroy"
+)
+
+// Event 容器生命周期中的一个事件，以 JSON 行的形式追加到事件日志中
+type Event struct {
+	Time       string            `json:"time"`
+	Type       string            `json:"type"`
+	Id         string            `json:"id"`
+	Name       string            `json:"name"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// RecordEvent 记录一个容器事件，记录失败只打印日志，不影响容器本身的操作
+func RecordEvent(eventType string, containerInfo *ContainerInfo, attributes map[string]string) {
+	event := &Event{
+		Time:       time.Now().Format(time.RFC3339Nano),
+		Type:       eventType,
+		Id:         containerInfo.Id,
+		Name:       containerInfo.Name,
+		Attributes: attributes,
+	}
+	if err := appendEvent(event); err != nil {
+		log.Warnf("record %s event of container %s error %v", eventType, containerInfo.Id, err)
+	}
+}
+
+func appendEvent(event *Event) error {
+	content, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(path.Dir(constant.EventsLog), constant.Perm0755); err != nil {
+		return err
+	}
+	// 多个进程可能同时写入，O_APPEND 保证每一行完整地追加到文件末尾
+	file, err := os.OpenFile(constant.EventsLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, constant.Perm0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(content, '\n'))
+	return err
+}
+
+// ListEvents 读取事件日志，containerName 不为空时只返回该容器(名称或ID)的事件
+func ListEvents(containerName string) ([]*Event, error) {
+	file, err := os.Open(constant.EventsLog)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "open file %s", constant.EventsLog)
+	}
+	defer file.Close()
+	var events []*Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		event := new(Event)
+		if err = json.Unmarshal(scanner.Bytes(), event); err != nil {
+			log.Warnf("skip invalid event %s", scanner.Text())
+			continue
+		}
+		if containerName != "" && event.Name != containerName && event.Id != containerName {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// String 格式与 docker events 类似，e.g. 2024-01-01T00:00:00Z container oom 1234567890 (name=test)
+func (e *Event) String() string {
+	attributes := []string{"name=" + e.Name}
+	keys := make([]string, 0, len(e.Attributes))
+	for key := range e.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		attributes = append(attributes, fmt.Sprintf("%s=%s", key, e.Attributes[key]))
+	}
+	return fmt.Sprintf("%s container %s %s (%s)", e.Time, e.Type, e.Id, strings.Join(attributes, ", "))
+}
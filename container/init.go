@@ -3,11 +3,14 @@ package container
 import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
-	"io"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runQ/constant"
+	"runQ/seccomp"
+	"runtime"
 	"strings"
 	"syscall"
 )
@@ -21,47 +24,156 @@ const fdIndex = 3
 使用mount先去挂载proc文件系统，以便后面通过ps等系统命令去查看当前进程资源的情况。
 */
 func RunContainerInitProcess() error {
-	// 按位或运算符，用于将多个标志组合在一起
-	//defaultMountFlags := syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
-	//_ = syscall.Mount("", constant.ROOTDIR, "", syscall.MS_PRIVATE|syscall.MS_REC, "")
-	//_ = syscall.Mount("proc", "/proc", "proc", uintptr(defaultMountFlags), "")
-	// argv := []string{command}
-	cmdArray := readUserCommand()
-	// 去除空格，提取所有命令
-	if len(cmdArray) == 0 {
-		return errors.New("run container get user command error,cmdArray is nil")
+	// capability 是线程级别的，设置 capability 和 execve 必须在同一个线程中执行
+	runtime.LockOSThread()
+	syncPipe := newSyncPipe()
+	defer syncPipe.Close()
+	// 正常情况下 execve 成功后不会返回，返回时一定是初始化失败，需要将错误报告给父进程
+	err := initContainer(syncPipe)
+	if syncErr := writeSync(syncPipe, &syncMessage{Type: syncError, Error: err.Error()}); syncErr != nil {
+		log.Errorf("Report init error to parent error %v", syncErr)
 	}
+	return err
+}
 
-	setupMount()
+// initContainer 按照 InitConfig 初始化容器，最后 execve 用户命令
+func initContainer(syncPipe *os.File) error {
+	pipe := os.NewFile(uintptr(fdIndex), "pipe")
+	config, err := readInitConfig(pipe)
+	_ = pipe.Close()
+	if err != nil {
+		return err
+	}
 
-	path, err := exec.LookPath(cmdArray[0])
+	// 需要在挂载之前创建，容器中挂载的 cgroupfs 才会以容器自己的 cgroup 为根
+	if config.Cgroupns {
+		if err = unix.Unshare(unix.CLONE_NEWCGROUP); err != nil {
+			return errors.Wrap(err, "unshare cgroup namespace")
+		}
+	}
+	if err = setupMount(config); err != nil {
+		return err
+	}
+	if err = setupLoopback(); err != nil {
+		return err
+	}
+	if config.Hostname != "" {
+		if err = syscall.Sethostname([]byte(config.Hostname)); err != nil {
+			return errors.Wrap(err, "set hostname")
+		}
+	}
+	if config.Domainname != "" {
+		if err = syscall.Setdomainname([]byte(config.Domainname)); err != nil {
+			return errors.Wrap(err, "set domainname")
+		}
+	}
+	cwd := config.Cwd
+	if cwd == "" {
+		cwd = constant.ROOTDIR
+	}
+	if err = syscall.Chdir(cwd); err != nil {
+		return errors.Wrapf(err, "chdir to %s", cwd)
+	}
+	// 用户命令使用配置中的环境变量，exec.LookPath 也需要根据其中的 PATH 查找命令
+	os.Clearenv()
+	for _, env := range config.Env {
+		if key, value, ok := strings.Cut(env, "="); ok {
+			_ = os.Setenv(key, value)
+		}
+	}
+	setContainerENV()
+	// pivot_root 之后解析用户，使用的是容器镜像中的 /etc/passwd 和 /etc/group
+	execUser, err := LookupUser(constant.ROOTDIR, config.User)
+	if err != nil {
+		return err
+	}
+	// 用户没有通过 -e 指定 HOME 时使用用户的 home 目录
+	if _, ok := os.LookupEnv("HOME"); !ok {
+		_ = os.Setenv("HOME", execUser.Home)
+	}
+	if err = setupRlimits(config.Rlimits); err != nil {
+		return err
+	}
+	// bounding set 需要在切换用户之前收缩，切换用户之后就没有 CAP_SETPCAP 了
+	caps, err := prepareCapabilities(config.Capabilities)
 	if err != nil {
-		log.Errorf("Exec loop path error %v", err)
 		return err
 	}
+	if err = setupUser(execUser); err != nil {
+		return err
+	}
+	if caps != nil {
+		if err = setCapabilities(caps); err != nil {
+			return err
+		}
+	}
+
+	path, err := exec.LookPath(config.Args[0])
+	if err != nil {
+		return errors.Wrapf(err, "look path %s", config.Args[0])
+	}
 
 	log.Infof("Find path %s", path)
+	if err = writeSync(syncPipe, &syncMessage{Type: syncReady}); err != nil {
+		return errors.Wrap(err, "report ready to parent")
+	}
+	// seccomp 在 execve 之前最后安装，之前的初始化步骤(包括向父进程报告 ready)不受过滤规则的限制
+	// 之后发送错误信息的 write 也可能被过滤掉，此时父进程只能等到 init 进程退出
+	if err = seccomp.Install(config.Seccomp); err != nil {
+		return err
+	}
 	// command-> /bin/sh
 	// argv ->  [/bin/sh]
-	if err := syscall.Exec(path, cmdArray[0:], os.Environ()); err != nil {
-		// syscall.Exec(command, argv, os.Environ()) 相当于调用系统执行命令，
-		// 并将当前进程替换为一个新的进程，同时将当前进程的环境变量传递给新的进程。
-		log.Errorf("RunContainerInitProcess exec : " + err.Error())
+	// syscall.Exec(command, argv, os.Environ()) 相当于调用系统执行命令，
+	// 并将当前进程替换为一个新的进程，同时将当前进程的环境变量传递给新的进程。
+	err = syscall.Exec(path, config.Args, os.Environ())
+	return errors.Wrapf(err, "exec %s", path)
+}
+
+func setupRlimits(rlimits []*Rlimit) error {
+	for _, rlimit := range rlimits {
+		if err := syscall.Setrlimit(rlimit.Type, &syscall.Rlimit{Cur: rlimit.Soft, Max: rlimit.Hard}); err != nil {
+			return errors.Wrapf(err, "set rlimit %d", rlimit.Type)
+		}
 	}
 	return nil
 }
 
-func readUserCommand() []string {
-	pipe := os.NewFile(uintptr(fdIndex), "pipe")
-	defer pipe.Close()
-	msg, err := io.ReadAll(pipe)
-	// msg [47 98 105 110 47 115 104] -> 转string，就是/bin/sh
+// setupUser 切换用户，顺序必须是 setgroups、setgid、setuid，切换 uid 之后就没有权限再修改组了
+func setupUser(user *ExecUser) error {
+	sgids := user.Sgids
+	if sgids == nil {
+		sgids = []int{}
+	}
+	// rootless 模式下 user namespace 禁用了 setgroups，没有附加组时不需要调用
+	if len(sgids) > 0 || !setgroupsDenied() {
+		if err := syscall.Setgroups(sgids); err != nil {
+			return errors.Wrap(err, "setgroups")
+		}
+	}
+	if err := syscall.Setgid(user.Gid); err != nil {
+		return errors.Wrapf(err, "setgid %d", user.Gid)
+	}
+	if err := syscall.Setuid(user.Uid); err != nil {
+		return errors.Wrapf(err, "setuid %d", user.Uid)
+	}
+	return nil
+}
+
+// setgroupsDenied user namespace 的 /proc/self/setgroups 为 deny 时不允许调用 setgroups
+func setgroupsDenied() bool {
+	content, err := os.ReadFile("/proc/self/setgroups")
+	return err == nil && strings.TrimSpace(string(content)) == "deny"
+}
+
+// setupLoopback 启用容器 network namespace 中的 loopback
+// 没有连接网络的容器(包括 rootless 模式下的容器)只能使用 loopback，新建的 network namespace 中它默认是 down 的
+func setupLoopback() error {
+	lo, err := netlink.LinkByName("lo")
 	if err != nil {
-		log.Errorf("init read pipe error %v", err)
-		return nil
+		return errors.Wrap(err, "find loopback")
 	}
-	msgStr := string(msg)
-	return strings.Split(msgStr, " ")
+	return errors.Wrap(netlink.LinkSetUp(lo), "set loopback up")
 }
 
 /*
@@ -69,11 +181,10 @@ func readUserCommand() []string {
 Init 挂载点
 */
 
-func setupMount() {
+func setupMount(config *InitConfig) error {
 	pwd, err := os.Getwd()
 	if err != nil {
-		log.Errorf("Get current location error %v", err)
-		return
+		return errors.Wrap(err, "get current location")
 	}
 
 	log.Infof("Current location is %s", pwd)
@@ -81,24 +192,83 @@ func setupMount() {
 	// 声明你要这个新的mount namespace独立。
 	// 如果不先做 private mount，会导致挂载事件外泄，后续执行 pivotRoot 会出现 invalid argument 错误
 	err = syscall.Mount("", constant.ROOTDIR, "", syscall.MS_PRIVATE|syscall.MS_REC, "")
+	// 挂载之后当前目录仍然是挂载点下面的空目录，后续都通过 pwd 路径访问 rootfs
+	if config.Rootfs != nil {
+		if err = syscall.Mount(config.Rootfs.Source, pwd, config.Rootfs.Device, uintptr(config.Rootfs.Flags), config.Rootfs.Data); err != nil {
+			return errors.Wrap(err, "mount rootfs")
+		}
+	}
+
+	// 配置中的挂载点需要在 pivot_root 之前挂载，此时还能访问到宿主机上的路径
+	for _, m := range config.Mounts {
+		if err = mountToRootfs(pwd, m); err != nil {
+			return err
+		}
+	}
 
-	err = pivotRoot(pwd)
+	if err = setupDev(pwd, config.Devices); err != nil {
+		return err
+	}
 
+	if err = pivotRoot(pwd); err != nil {
+		return errors.WithMessage(err, "pivotRoot failed")
+	}
+	if err = writeSysctls(config.Sysctls); err != nil {
+		return err
+	}
+	if err = maskPaths(config.MaskedPaths); err != nil {
+		return err
+	}
+	if err = readonlyPaths(config.ReadonlyPaths); err != nil {
+		return err
+	}
+	// pivotRoot 时 rootfs 已经 bind mount 到自己，只 remount 根目录，/proc、/dev、tmpfs 等挂载点仍然可写
+	if config.Readonly {
+		return remountReadonly(constant.ROOTDIR)
+	}
+	return nil
+}
+
+// mountToRootfs 将挂载点挂载到 rootfs 下，只读的 bind mount 需要再 remount 一次才能生效
+// 挂载点路径中的软链接在 rootfs 内解析，不能挂载到宿主机的目录上
+func mountToRootfs(rootfs string, m *Mount) error {
+	dest, err := securePath(rootfs, m.Destination)
 	if err != nil {
-		log.Errorf("pivotRoot failed,detail: %v", err)
-		return
-	}
-	// mount /proc
-	defaultMountFlags := syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
-	_ = syscall.Mount("proc", "/proc", "proc", uintptr(defaultMountFlags), "")
-
-	// tmpfs 是基于 件系 使用 RAM、swap 分区来存储。
-	// 不挂载 /dev，会导致容器内部无法访问和使用许多设备，这可能导致系统无法正常工作
-	_ = syscall.Mount("tmpfs", "/dev", "tmpfs", syscall.MS_NOSUID|syscall.MS_STRICTATIME, "mode=755")
-	// Set PATH environment variable
-	// ++++NEW++++
-	// 需要指定好环境变量，否则进入到容器后无法使用命令
-	setContainerENV()
+		return err
+	}
+	if dest == filepath.Clean(rootfs) {
+		return errors.Errorf("mount destination %s resolves to the container's root", m.Destination)
+	}
+	if err = createMountpoint(m, dest); err != nil {
+		return err
+	}
+	if err := syscall.Mount(m.Source, dest, m.Device, uintptr(m.Flags), m.Data); err != nil {
+		return errors.Wrapf(err, "mount %s to %s", m.Source, m.Destination)
+	}
+	if m.Flags&syscall.MS_BIND != 0 && m.Flags&syscall.MS_RDONLY != 0 {
+		flags := uintptr(m.Flags | syscall.MS_REMOUNT)
+		if err := syscall.Mount("", dest, "", flags, ""); err != nil {
+			return errors.Wrapf(err, "remount %s read-only", m.Destination)
+		}
+	}
+	return nil
+}
+
+// createMountpoint bind mount 一个文件时挂载点也需要是文件
+func createMountpoint(m *Mount, dest string) error {
+	if m.Flags&syscall.MS_BIND != 0 {
+		if info, err := os.Stat(m.Source); err == nil && !info.IsDir() {
+			if err = os.MkdirAll(filepath.Dir(dest), constant.Perm0755); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(dest, os.O_CREATE, constant.Perm0644)
+			if err != nil {
+				return err
+			}
+			return file.Close()
+		}
+	}
+	return os.MkdirAll(dest, constant.Perm0755)
 }
 
 func pivotRoot(root string) error {
@@ -0,0 +1,83 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"runQ/seccomp"
+)
+
+// InitConfigVersion init 配置的版本，父子进程的格式不一致时(e.g. 升级 runQ 时仍有旧版本的进程)直接报错，而不是按错误的格式解析
+const InitConfigVersion = 1
+
+// InitConfig 父进程通过 fd 3 的管道以 JSON 格式发送给容器 init 进程的配置
+// 以前只发送空格拼接的命令，包含空格、空字符串的参数都会被拆坏
+type InitConfig struct {
+	Version  int       `json:"version"`
+	Args     []string  `json:"args"`               // 用户命令及其参数
+	Env      []string  `json:"env"`                // 用户命令的环境变量，e.g. PATH=/bin
+	Cwd      string    `json:"cwd"`                // 用户命令的工作目录，为空时为 /
+	User     string    `json:"user,omitempty"`     // 运行用户命令的用户，user[:group]，为空时为 root
+	Hostname string    `json:"hostname,omitempty"` // 容器的主机名，为空时不修改(e.g. --uts host)
+	Mounts   []*Mount  `json:"mounts,omitempty"`   // pivot_root 之前挂载到 rootfs 中的挂载点
+	Rlimits  []*Rlimit `json:"rlimits,omitempty"`  // execve 之前通过 setrlimit 设置的资源限制
+	Devices  []*Device `json:"devices,omitempty"`  // 挂载点挂载完成后在 /dev 中创建的设备
+	// Capabilities 用户命令保留的 capability，为 nil 时不修改，空列表表示删除所有 capability，因此不能 omitempty
+	Capabilities  []string `json:"capabilities"`
+	MaskedPaths   []string `json:"maskedPaths,omitempty"`   // pivot_root 之后屏蔽的路径
+	ReadonlyPaths []string `json:"readonlyPaths,omitempty"` // pivot_root 之后只读的路径
+	Readonly      bool     `json:"readonly,omitempty"`      // 根文件系统只读
+	// Seccomp 父进程编译好的 seccomp 过滤程序，为空时不过滤
+	Seccomp seccomp.Program `json:"seccomp,omitempty"`
+	// Sysctls pivot_root 之后写入容器 /proc/sys 的 sysctl，key 为 net.core.somaxconn 这样的格式
+	Sysctls map[string]string `json:"sysctls,omitempty"`
+	// Domainname 容器的 NIS 域名，与 Hostname 一样在 --uts host 时为空
+	Domainname string `json:"domainname,omitempty"`
+	// Cgroupns 在父进程把 init 进程加入容器的 cgroup 之后创建 cgroup namespace，容器中只能看到自己的 cgroup
+	Cgroupns bool `json:"cgroupns,omitempty"`
+	// Rootfs 不为空时由 init 进程把它挂载到当前目录作为 rootfs，rootless 模式下宿主机上无法挂载 overlay
+	Rootfs *Mount `json:"rootfs,omitempty"`
+}
+
+// Mount 容器内的挂载点，Destination 为容器内的路径
+type Mount struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Device      string `json:"device"` // 文件系统类型，e.g. tmpfs、proc，bind mount 时为 bind
+	Flags       int    `json:"flags,omitempty"`
+	Data        string `json:"data,omitempty"`
+}
+
+// Rlimit 进程的资源限制，Type 为 syscall.RLIMIT_* 常量
+type Rlimit struct {
+	Type int    `json:"type"`
+	Soft uint64 `json:"soft"`
+	Hard uint64 `json:"hard"`
+}
+
+// SendInitConfig 将配置写入管道后关闭管道，子进程读到 EOF 后开始解析
+func SendInitConfig(writePipe *os.File, config *InitConfig) error {
+	defer writePipe.Close()
+	config.Version = InitConfigVersion
+	if err := json.NewEncoder(writePipe).Encode(config); err != nil {
+		return errors.Wrap(err, "send init config")
+	}
+	return nil
+}
+
+// readInitConfig 从管道中读取父进程发送的配置
+func readInitConfig(pipe io.Reader) (*InitConfig, error) {
+	config := new(InitConfig)
+	if err := json.NewDecoder(pipe).Decode(config); err != nil {
+		return nil, errors.Wrap(err, "decode init config")
+	}
+	if config.Version != InitConfigVersion {
+		return nil, fmt.Errorf("unsupported init config version %d, expected %d", config.Version, InitConfigVersion)
+	}
+	if len(config.Args) == 0 {
+		return nil, errors.New("run container get user command error, args is empty")
+	}
+	return config, nil
+}
@@ -0,0 +1,36 @@
+package container
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestInitConfigRoundTrip(t *testing.T) {
+	readPipe, writePipe, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readPipe.Close()
+	// 包含空格和空字符串的参数也需要原样传递
+	args := []string{"sh", "-c", "echo a  b", ""}
+	if err = SendInitConfig(writePipe, &InitConfig{Args: args, Env: []string{"A=1"}}); err != nil {
+		t.Fatal(err)
+	}
+	config, err := readInitConfig(readPipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config.Args, args) {
+		t.Errorf("args = %q, expected %q", config.Args, args)
+	}
+}
+
+func TestInitConfigVersionMismatch(t *testing.T) {
+	content, _ := json.Marshal(&InitConfig{Version: InitConfigVersion + 1, Args: []string{"sh"}})
+	if _, err := readInitConfig(bytes.NewReader(content)); err == nil {
+		t.Error("read init config of another version should fail")
+	}
+}
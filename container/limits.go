@@ -0,0 +1,123 @@
+package container
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"path"
+	"runQ/constant"
+	"strconv"
+	"strings"
+)
+
+// rlimitTypes --ulimit 支持的资源
+var rlimitTypes = map[string]int{
+	"as":         unix.RLIMIT_AS,
+	"core":       unix.RLIMIT_CORE,
+	"cpu":        unix.RLIMIT_CPU,
+	"data":       unix.RLIMIT_DATA,
+	"fsize":      unix.RLIMIT_FSIZE,
+	"locks":      unix.RLIMIT_LOCKS,
+	"memlock":    unix.RLIMIT_MEMLOCK,
+	"msgqueue":   unix.RLIMIT_MSGQUEUE,
+	"nice":       unix.RLIMIT_NICE,
+	"nofile":     unix.RLIMIT_NOFILE,
+	"nproc":      unix.RLIMIT_NPROC,
+	"rss":        unix.RLIMIT_RSS,
+	"rtprio":     unix.RLIMIT_RTPRIO,
+	"rttime":     unix.RLIMIT_RTTIME,
+	"sigpending": unix.RLIMIT_SIGPENDING,
+	"stack":      unix.RLIMIT_STACK,
+}
+
+// ipcSysctls 属于 ipc namespace 的 sysctl，fs.mqueue.* 也属于 ipc namespace
+var ipcSysctls = map[string]bool{
+	"kernel.msgmax":          true,
+	"kernel.msgmnb":          true,
+	"kernel.msgmni":          true,
+	"kernel.sem":             true,
+	"kernel.shmall":          true,
+	"kernel.shmmax":          true,
+	"kernel.shmmni":          true,
+	"kernel.shm_rmid_forced": true,
+}
+
+const (
+	mqueueSysctlPrefix = "fs.mqueue."
+	netSysctlPrefix    = "net."
+)
+
+// ParseUlimit 解析 --ulimit，格式为 name=soft[:hard]，没有指定 hard 时与 soft 相同，-1 表示不限制
+func ParseUlimit(val string) (*Rlimit, error) {
+	name, limits, ok := strings.Cut(val, "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid ulimit %s, must be <name>=<soft>[:<hard>]", val)
+	}
+	rlimitType, ok := rlimitTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid ulimit %s, unknown resource %s", val, name)
+	}
+	softStr, hardStr, ok := strings.Cut(limits, ":")
+	if !ok {
+		hardStr = softStr
+	}
+	soft, err := parseRlimitValue(softStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ulimit %s: %v", val, err)
+	}
+	hard, err := parseRlimitValue(hardStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ulimit %s: %v", val, err)
+	}
+	if soft > hard {
+		return nil, fmt.Errorf("invalid ulimit %s, soft limit must not be greater than hard limit", val)
+	}
+	return &Rlimit{Type: rlimitType, Soft: soft, Hard: hard}, nil
+}
+
+func parseRlimitValue(val string) (uint64, error) {
+	if val == "-1" {
+		return unix.RLIM_INFINITY, nil
+	}
+	return strconv.ParseUint(val, 10, 64)
+}
+
+// ValidateSysctl 容器中只能修改属于自己的 ipc、network namespace 的 sysctl，其他的会影响宿主机
+// 共享宿主机或者其他容器的 ipc namespace 时也不能修改 ipc 相关的 sysctl
+func ValidateSysctl(key string, namespaces *Namespaces) error {
+	if strings.Contains(key, "/") {
+		return fmt.Errorf("invalid sysctl %s", key)
+	}
+	if ipcSysctls[key] || strings.HasPrefix(key, mqueueSysctlPrefix) {
+		if !namespaces.privateIpc() {
+			return fmt.Errorf("sysctl %s can not be set when the ipc namespace is shared", key)
+		}
+		return nil
+	}
+	// 容器总是使用自己的 network namespace
+	if strings.HasPrefix(key, netSysctlPrefix) {
+		return nil
+	}
+	return fmt.Errorf("sysctl %s is not allowed in the container, only kernel.msg*, kernel.sem, kernel.shm*, fs.mqueue.* and net.* can be set", key)
+}
+
+// writeSysctls 在容器的 /proc/sys 中写入 sysctl，需要在 /proc/sys 只读之前执行
+func writeSysctls(sysctls map[string]string) error {
+	for key, value := range sysctls {
+		p := path.Join("/proc/sys", strings.ReplaceAll(key, ".", "/"))
+		if err := os.WriteFile(p, []byte(value), constant.Perm0644); err != nil {
+			return errors.Wrapf(err, "set sysctl %s", key)
+		}
+	}
+	return nil
+}
+
+// SetOOMScoreAdj 由父进程在 init 进程 execve 之前设置，用户命令及其子进程都会继承
+func SetOOMScoreAdj(pid, score int) error {
+	p := fmt.Sprintf("/proc/%d/oom_score_adj", pid)
+	if err := os.WriteFile(p, []byte(strconv.Itoa(score)), constant.Perm0644); err != nil {
+		return errors.Wrapf(err, "write %s", p)
+	}
+	return nil
+}
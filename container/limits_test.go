@@ -0,0 +1,46 @@
+package container
+
+import (
+	"golang.org/x/sys/unix"
+	"testing"
+)
+
+func TestParseUlimit(t *testing.T) {
+	rlimit, err := ParseUlimit("nofile=1024:65536")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rlimit.Type != unix.RLIMIT_NOFILE || rlimit.Soft != 1024 || rlimit.Hard != 65536 {
+		t.Errorf("unexpected rlimit %+v", rlimit)
+	}
+	// 没有指定 hard 时与 soft 相同，-1 表示不限制
+	if rlimit, err = ParseUlimit("core=-1"); err != nil || rlimit.Soft != unix.RLIM_INFINITY || rlimit.Hard != unix.RLIM_INFINITY {
+		t.Errorf("unexpected rlimit %+v, err %v", rlimit, err)
+	}
+	for _, val := range []string{"nofile", "files=10", "nofile=abc", "nofile=2048:1024", "nproc=-2"} {
+		if _, err = ParseUlimit(val); err == nil {
+			t.Errorf("ParseUlimit(%s) expected error", val)
+		}
+	}
+}
+
+func TestValidateSysctl(t *testing.T) {
+	private := &Namespaces{}
+	for _, key := range []string{"net.core.somaxconn", "net.ipv4.ip_forward", "kernel.shmmax", "fs.mqueue.msg_max"} {
+		if err := ValidateSysctl(key, private); err != nil {
+			t.Errorf("ValidateSysctl(%s) unexpected error %v", key, err)
+		}
+	}
+	for _, key := range []string{"kernel.hostname", "vm.swappiness", "kernel.shmmax/../x", "net.ipv4/../../vm"} {
+		if err := ValidateSysctl(key, private); err == nil {
+			t.Errorf("ValidateSysctl(%s) expected error", key)
+		}
+	}
+	// 共享 ipc namespace 时不能修改 ipc 相关的 sysctl
+	if err := ValidateSysctl("kernel.sem", &Namespaces{Ipc: NamespaceHost}); err == nil {
+		t.Error("ValidateSysctl(kernel.sem) with ipc host expected error")
+	}
+	if err := ValidateSysctl("net.core.somaxconn", &Namespaces{Ipc: NamespaceHost}); err != nil {
+		t.Errorf("ValidateSysctl(net.core.somaxconn) unexpected error %v", err)
+	}
+}
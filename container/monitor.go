@@ -0,0 +1,127 @@
+package container
+
+import (
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/exec"
+	"runQ/cgroups"
+	"runQ/constant"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const monitorInterval = 500 * time.Millisecond
+
+// StartMonitor 为后台运行的容器启动一个独立的 monitor 进程
+// runQ run -d 在容器启动后就会退出，需要由 monitor 进程监听 OOM 事件并在容器退出后更新容器状态
+func StartMonitor(containerId string) error {
+	cmd := exec.Command(constant.EXECSELF, "monitor", containerId)
+	// 使用新的会话，避免终端关闭时 monitor 进程收到 SIGHUP
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "start monitor process")
+	}
+	return cmd.Process.Release()
+}
+
+// OOMWatcher 监听容器 cgroup 的 OOM 事件
+type OOMWatcher struct {
+	containerInfo *ContainerInfo
+	manager       *cgroups.CgroupManager
+	oomKilled     chan struct{}
+}
+
+// WatchOOM 开始监听容器的 OOM 事件，每次发生 OOM 都会记录一个 oom 事件
+func WatchOOM(containerInfo *ContainerInfo) *OOMWatcher {
+	w := &OOMWatcher{
+		containerInfo: containerInfo,
+		oomKilled:     make(chan struct{}),
+	}
+	// rootless 模式下没有可用的 cgroup 时不监听
+	if containerInfo.CgroupPath == "" {
+		return w
+	}
+	w.manager = cgroups.NewCgroupManager(containerInfo.CgroupPath)
+	ch, err := w.manager.NotifyOOM()
+	if err != nil {
+		// 监听失败时仍然可以在容器退出后通过 OOM 计数判断
+		log.Warnf("watch oom event of container %s error %v", containerInfo.Id, err)
+		return w
+	}
+	go func() {
+		first := true
+		for range ch {
+			log.Warnf("container %s out of memory", containerInfo.Id)
+			RecordEvent(EventOOM, containerInfo, nil)
+			if first {
+				close(w.oomKilled)
+				first = false
+			}
+		}
+	}()
+	return w
+}
+
+// OOMKilled 容器运行期间是否有进程被 OOM killer 杀死，需要在 cgroup 删除之前调用
+func (w *OOMWatcher) OOMKilled() bool {
+	select {
+	case <-w.oomKilled:
+		return true
+	default:
+	}
+	if w.manager == nil {
+		return false
+	}
+	// eventfd/inotify 的通知是异步的，容器退出时可能还没有收到，再检查一次计数
+	count, err := w.manager.OOMKillCount()
+	if err != nil {
+		log.Debugf("get oom kill count of container %s error %v", w.containerInfo.Id, err)
+		return false
+	}
+	return count > 0
+}
+
+// ExitReason 容器退出的原因
+func (w *OOMWatcher) ExitReason() (bool, string) {
+	if w.OOMKilled() {
+		return true, constant.ExitReasonOOMKilled
+	}
+	return false, constant.ExitReasonExited
+}
+
+// MonitorContainer monitor 进程的入口，等待容器退出后将 OOM 信息和退出原因写入容器信息
+func MonitorContainer(containerId string) error {
+	containerInfo, err := getContainerInfoByContainerId(containerId)
+	if err != nil {
+		return err
+	}
+	pid, err := strconv.Atoi(containerInfo.Pid)
+	if err != nil {
+		return errors.Wrapf(err, "invalid pid %s", containerInfo.Pid)
+	}
+	watcher := WatchOOM(containerInfo)
+	// monitor 不是容器进程的父进程，无法 wait，只能轮询进程是否存在
+	for syscall.Kill(pid, 0) != syscall.ESRCH {
+		time.Sleep(monitorInterval)
+	}
+	oomKilled, reason := watcher.ExitReason()
+	RecordEvent(EventDie, containerInfo, map[string]string{"exitReason": reason})
+
+	// 重新读取容器信息，容器可能已经被 stop 或 rm
+	containerInfo, err = getContainerInfoByContainerId(containerId)
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	containerInfo.OOMKilled = oomKilled
+	containerInfo.ExitReason = reason
+	containerInfo.FinishedAt = time.Now().Format(time.RFC3339)
+	// 被 stop 的容器保持 stopped 状态
+	if containerInfo.Status == constant.RUNNING {
+		containerInfo.Status = constant.EXIT
+	}
+	return UpdateContainerInfo(containerInfo)
+}
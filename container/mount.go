@@ -60,6 +60,12 @@ func mountOverlayFS(containerId string) {
 	}
 }
 
+// OverlayMount rootless 模式下宿主机上没有权限挂载 overlay，由 init 进程在容器的 user namespace 中挂载到 rootfs
+func OverlayMount(containerId string) *Mount {
+	dirs := utils.GetOverlayFsDirs(utils.GetLower(containerId), utils.GetUpper(containerId), utils.GetWorker(containerId))
+	return &Mount{Source: "overlay", Destination: constant.ROOTDIR, Device: "overlay", Data: dirs}
+}
+
 func deleteDirs(containerId string) {
 	dirs := []string{
 		utils.GetMerged(containerId),
@@ -0,0 +1,179 @@
+package container
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// DefaultMaskedPaths 容器中屏蔽的路径，这些路径会泄露宿主机的信息，与 docker 一致
+var DefaultMaskedPaths = []string{
+	"/proc/asound",
+	"/proc/acpi",
+	"/proc/kcore",
+	"/proc/keys",
+	"/proc/latency_stats",
+	"/proc/timer_list",
+	"/proc/timer_stats",
+	"/proc/sched_debug",
+	"/proc/scsi",
+	"/sys/firmware",
+	"/sys/devices/virtual/powercap",
+}
+
+// DefaultReadonlyPaths 容器中只读的路径，写入这些路径会修改宿主机内核的配置
+var DefaultReadonlyPaths = []string{
+	"/proc/bus",
+	"/proc/fs",
+	"/proc/irq",
+	"/proc/sys",
+	"/proc/sysrq-trigger",
+}
+
+// tmpfsFlags --tmpfs 中可以使用的挂载选项，其余选项作为 tmpfs 的参数，e.g. size=64m
+var tmpfsFlags = map[string]struct {
+	clear bool
+	flag  int
+}{
+	"ro":     {false, syscall.MS_RDONLY},
+	"rw":     {true, syscall.MS_RDONLY},
+	"nosuid": {false, syscall.MS_NOSUID},
+	"suid":   {true, syscall.MS_NOSUID},
+	"nodev":  {false, syscall.MS_NODEV},
+	"dev":    {true, syscall.MS_NODEV},
+	"noexec": {false, syscall.MS_NOEXEC},
+	"exec":   {true, syscall.MS_NOEXEC},
+}
+
+// maxSymlinks 解析路径时最多跟随的软链接数量，与内核的 MAXSYMLINKS 一致，防止循环链接
+const maxSymlinks = 40
+
+// securePath 在 rootfs 中解析 unsafePath，软链接(包括绝对路径的软链接)和 .. 都限制在 rootfs 内
+// pivot_root 之前直接拼接路径时，镜像中的 /var/run -> /run 这类软链接会被解析到宿主机上的路径
+// 不存在的路径不再解析，按原样拼接到已解析的部分后面
+func securePath(rootfs, unsafePath string) (string, error) {
+	current := "/"
+	remaining := unsafePath
+	links := 0
+	for remaining != "" {
+		part, rest, _ := strings.Cut(remaining, "/")
+		remaining = rest
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			current = filepath.Dir(current)
+			continue
+		}
+		next := filepath.Join(current, part)
+		info, err := os.Lstat(filepath.Join(rootfs, next))
+		if err != nil {
+			if os.IsNotExist(err) {
+				current = next
+				continue
+			}
+			return "", errors.Wrapf(err, "resolve %s", unsafePath)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", fmt.Errorf("resolve %s: too many levels of symbolic links", unsafePath)
+		}
+		target, err := os.Readlink(filepath.Join(rootfs, next))
+		if err != nil {
+			return "", errors.Wrapf(err, "resolve %s", unsafePath)
+		}
+		// 绝对路径的软链接从 rootfs 的根目录重新解析
+		if filepath.IsAbs(target) {
+			current = "/"
+		}
+		remaining = target + "/" + remaining
+	}
+	return filepath.Join(rootfs, current), nil
+}
+
+// ParseTmpfs 解析 --tmpfs 参数，格式为 <path>[:<options>]，e.g. /run:size=64m,exec
+// 默认的挂载选项为 nosuid,nodev,noexec，与 docker 一致
+func ParseTmpfs(val string) (*Mount, error) {
+	dest, options, _ := strings.Cut(val, ":")
+	if !filepath.IsAbs(dest) {
+		return nil, fmt.Errorf("invalid tmpfs %s, path must be absolute", val)
+	}
+	if filepath.Clean(dest) == "/" {
+		return nil, fmt.Errorf("invalid tmpfs %s, can not mount tmpfs on /", val)
+	}
+	flags := syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC
+	var data []string
+	for _, opt := range strings.Split(options, ",") {
+		if opt == "" {
+			continue
+		}
+		if f, ok := tmpfsFlags[opt]; ok {
+			if f.clear {
+				flags &^= f.flag
+			} else {
+				flags |= f.flag
+			}
+			continue
+		}
+		data = append(data, opt)
+	}
+	return &Mount{Source: "tmpfs", Destination: filepath.Clean(dest), Device: "tmpfs", Flags: flags, Data: strings.Join(data, ",")}, nil
+}
+
+// maskPaths 屏蔽路径，目录挂载一个只读的空 tmpfs，文件 bind mount /dev/null，路径不存在时忽略
+// 需要在 pivot_root 之后执行，此时 /proc、/sys 和 /dev/null 都已经是容器中的
+func maskPaths(paths []string) error {
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "stat masked path %s", p)
+		}
+		if info.IsDir() {
+			err = syscall.Mount("tmpfs", p, "tmpfs", syscall.MS_RDONLY, "")
+		} else {
+			err = syscall.Mount("/dev/null", p, "", syscall.MS_BIND, "")
+		}
+		if err != nil {
+			return errors.Wrapf(err, "mask path %s", p)
+		}
+	}
+	return nil
+}
+
+// readonlyPaths 将路径 bind mount 到自己后 remount 为只读，路径不存在时忽略
+func readonlyPaths(paths []string) error {
+	for _, p := range paths {
+		if err := syscall.Mount(p, p, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrapf(err, "bind mount readonly path %s", p)
+		}
+		if err := remountReadonly(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remountReadonly 将 bind mount 重新挂载为只读，需要保留原挂载点的 nosuid、nodev、noexec，否则 remount 会清除这些选项
+func remountReadonly(p string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(p, &st); err != nil {
+		return errors.Wrapf(err, "statfs %s", p)
+	}
+	flags := uintptr(st.Flags) & (syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+	if err := syscall.Mount("", p, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|flags, ""); err != nil {
+		return errors.Wrapf(err, "remount %s read-only", p)
+	}
+	return nil
+}
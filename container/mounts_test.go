@@ -0,0 +1,79 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestParseTmpfs(t *testing.T) {
+	defaultFlags := syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC
+	tests := []struct {
+		val     string
+		want    *Mount
+		wantErr bool
+	}{
+		{val: "/run", want: &Mount{Source: "tmpfs", Destination: "/run", Device: "tmpfs", Flags: defaultFlags}},
+		{val: "/run/:size=64m,exec,mode=1777", want: &Mount{Source: "tmpfs", Destination: "/run", Device: "tmpfs",
+			Flags: syscall.MS_NOSUID | syscall.MS_NODEV, Data: "size=64m,mode=1777"}},
+		{val: "/tmp:ro", want: &Mount{Source: "tmpfs", Destination: "/tmp", Device: "tmpfs", Flags: defaultFlags | syscall.MS_RDONLY}},
+		{val: "run", wantErr: true},
+		{val: "/", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.val, func(t *testing.T) {
+			mount, err := ParseTmpfs(test.val)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseTmpfs() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(mount, test.want) {
+				t.Errorf("ParseTmpfs() = %+v, expected %+v", mount, test.want)
+			}
+		})
+	}
+}
+
+func TestSecurePath(t *testing.T) {
+	rootfs := t.TempDir()
+	for _, dir := range []string{"run", "etc", "var"} {
+		if err := os.Mkdir(filepath.Join(rootfs, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"var/run":         "/run",
+		"etc/resolv.conf": "../run/resolv.conf",
+		"escape":          "../../../..",
+		"loop":            "loop",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(rootfs, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/var/run", want: "/run"},
+		{path: "/var/run/lock", want: "/run/lock"},
+		{path: "/etc/resolv.conf", want: "/run/resolv.conf"},
+		{path: "/escape/etc", want: "/etc"},
+		{path: "/../../tmp", want: "/tmp"},
+		{path: "/new/dir", want: "/new/dir"},
+	}
+	for _, test := range tests {
+		got, err := securePath(rootfs, test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != filepath.Join(rootfs, test.want) {
+			t.Errorf("securePath(%s) = %s, expected %s", test.path, got, filepath.Join(rootfs, test.want))
+		}
+	}
+	if _, err := securePath(rootfs, "/loop"); err == nil {
+		t.Error("securePath(/loop) expected error")
+	}
+}
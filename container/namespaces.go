@@ -0,0 +1,220 @@
+package container
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"os/exec"
+	"runQ/constant"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// namespace 的模式，为空时与 private 相同，创建新的 namespace
+const (
+	NamespacePrivate   = "private"
+	NamespaceShareable = "shareable" // 创建新的 ipc namespace，并允许其他容器通过 container:<name> 加入
+	NamespaceHost      = "host"      // 不创建新的 namespace，使用宿主机的
+	containerNSPrefix  = "container:"
+)
+
+// time namespace 中可以设置偏移的时钟
+const (
+	ClockMonotonic = "monotonic"
+	ClockBoottime  = "boottime"
+)
+
+// Namespaces 容器的 namespace 配置，mnt 和 net namespace 总是新建的
+type Namespaces struct {
+	Pid      string `json:"pid,omitempty"`      // 为空时新建，host 或 container:<name>
+	Ipc      string `json:"ipc,omitempty"`      // private(默认)、shareable、host 或 container:<name>
+	Uts      string `json:"uts,omitempty"`      // 为空时新建，host
+	Cgroupns string `json:"cgroupns,omitempty"` // private(默认) 或 host
+	// TimeOffsets 不为空时创建 time namespace 并设置其中时钟的偏移
+	TimeOffsets []*TimeOffset `json:"timeOffsets,omitempty"`
+}
+
+// TimeOffset time namespace 中的时钟相对于宿主机的偏移
+type TimeOffset struct {
+	Clock  string        `json:"clock"`
+	Offset time.Duration `json:"offset"`
+}
+
+// ParseTimeOffset 解析 --time-offset，格式为 clock=duration，e.g. --time-offset boottime=24h
+func ParseTimeOffset(val string) (*TimeOffset, error) {
+	clock, value, ok := strings.Cut(val, "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid time offset %s, must be <clock>=<duration>", val)
+	}
+	if clock != ClockMonotonic && clock != ClockBoottime {
+		return nil, fmt.Errorf("invalid clock %s, must be %s or %s", clock, ClockMonotonic, ClockBoottime)
+	}
+	offset, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time offset %s: %v", val, err)
+	}
+	return &TimeOffset{Clock: clock, Offset: offset}, nil
+}
+
+// Validate 检查各个 namespace 的模式
+func (n *Namespaces) Validate() error {
+	if err := validateNamespaceMode("pid", n.Pid, NamespaceHost); err != nil {
+		return err
+	}
+	if err := validateNamespaceMode("ipc", n.Ipc, NamespacePrivate, NamespaceShareable, NamespaceHost); err != nil {
+		return err
+	}
+	if n.Uts != "" && n.Uts != NamespaceHost {
+		return fmt.Errorf("invalid uts mode %s, must be %s", n.Uts, NamespaceHost)
+	}
+	if n.Cgroupns != "" && n.Cgroupns != NamespacePrivate && n.Cgroupns != NamespaceHost {
+		return fmt.Errorf("invalid cgroupns mode %s, must be %s or %s", n.Cgroupns, NamespacePrivate, NamespaceHost)
+	}
+	return nil
+}
+
+func validateNamespaceMode(ns, mode string, modes ...string) error {
+	if mode == "" {
+		return nil
+	}
+	for _, m := range modes {
+		if mode == m {
+			return nil
+		}
+	}
+	if name, ok := strings.CutPrefix(mode, containerNSPrefix); ok && name != "" {
+		return nil
+	}
+	return fmt.Errorf("invalid %s mode %s, must be one of %s or container:<name>", ns, mode, strings.Join(modes, ", "))
+}
+
+// Shared 是否使用了宿主机或者其他容器的 pid、ipc namespace
+// 这些 namespace 不属于容器的 user namespace，在其中无法挂载 proc、mqueue
+func (n *Namespaces) Shared() bool {
+	return n.Pid != "" || !n.privateIpc()
+}
+
+// privateIpc 是否使用容器自己的 ipc namespace
+func (n *Namespaces) privateIpc() bool {
+	return n.Ipc == "" || n.Ipc == NamespacePrivate || n.Ipc == NamespaceShareable
+}
+
+// PrivateCgroupns 默认使用独立的 cgroup namespace
+func (n *Namespaces) PrivateCgroupns() bool {
+	return n.Cgroupns != NamespaceHost
+}
+
+// cloneFlags 创建子进程时需要新建的 namespace
+// cgroup namespace 的根是创建时所在的 cgroup，需要等父进程把 init 进程加入容器的 cgroup 之后由 init 进程 unshare
+// time namespace 不能通过 clone 创建，由 init 进程在 nsenter 中 unshare
+func (n *Namespaces) cloneFlags() uintptr {
+	flags := uintptr(syscall.CLONE_NEWNS | syscall.CLONE_NEWNET)
+	if n.Pid == "" {
+		flags |= syscall.CLONE_NEWPID
+	}
+	if n.privateIpc() {
+		flags |= syscall.CLONE_NEWIPC
+	}
+	if n.Uts != NamespaceHost {
+		flags |= syscall.CLONE_NEWUTS
+	}
+	return flags
+}
+
+// timensOffsets 写入 /proc/self/timens_offsets 的内容，每行为 <clock> <secs> <nanosecs>，nanosecs 不能为负数
+func (n *Namespaces) timensOffsets() string {
+	var b strings.Builder
+	for _, o := range n.TimeOffsets {
+		secs, nsecs := int64(o.Offset/time.Second), int64(o.Offset%time.Second)
+		if nsecs < 0 {
+			secs--
+			nsecs += int64(time.Second)
+		}
+		_, _ = fmt.Fprintf(&b, "%s %d %d\n", o.Clock, secs, nsecs)
+	}
+	return b.String()
+}
+
+// sharedContainer 解析 container:<name> 模式，返回要共享 namespace 的容器，其他模式返回 nil
+func sharedContainer(mode string) (*ContainerInfo, error) {
+	name, ok := strings.CutPrefix(mode, containerNSPrefix)
+	if !ok {
+		return nil, nil
+	}
+	info, err := GetContainerInfoByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.Status != constant.RUNNING {
+		return nil, fmt.Errorf("container %s is not running", name)
+	}
+	return info, nil
+}
+
+// joinPaths 需要加入的其他容器的 namespace，key 为 namespace 的类型
+// host 模式不需要加入，子进程直接继承 runQ 所在的 namespace
+func (n *Namespaces) joinPaths() (map[int]string, error) {
+	paths := map[int]string{}
+	pidContainer, err := sharedContainer(n.Pid)
+	if err != nil {
+		return nil, errors.WithMessage(err, "join pid namespace")
+	}
+	if pidContainer != nil {
+		paths[syscall.CLONE_NEWPID] = fmt.Sprintf("/proc/%s/ns/pid", pidContainer.Pid)
+	}
+	ipcContainer, err := sharedContainer(n.Ipc)
+	if err != nil {
+		return nil, errors.WithMessage(err, "join ipc namespace")
+	}
+	if ipcContainer != nil {
+		if ipcContainer.Namespaces == nil || ipcContainer.Namespaces.Ipc != NamespaceShareable {
+			return nil, fmt.Errorf("ipc namespace of container %s is not shareable", ipcContainer.Name)
+		}
+		paths[syscall.CLONE_NEWIPC] = fmt.Sprintf("/proc/%s/ns/ipc", ipcContainer.Pid)
+	}
+	return paths, nil
+}
+
+// ShmMount 使用宿主机的 ipc namespace 时 POSIX 共享内存所在的 /dev/shm 也使用宿主机的，返回 nil 时使用容器自己的 tmpfs
+// 其他容器的 /dev/shm 在它自己的 mount namespace 中，无法 bind mount，container:<name> 模式只共享 System V IPC
+func (n *Namespaces) ShmMount() *Mount {
+	if n.Ipc != NamespaceHost {
+		return nil
+	}
+	return &Mount{Source: "/dev/shm", Destination: "/dev/shm", Device: "bind", Flags: syscall.MS_BIND | syscall.MS_REC}
+}
+
+// startInNamespaces 在加入了 paths 中 namespace 的线程上启动子进程，子进程会继承该线程的 namespace
+// 该线程 LockOSThread 之后不再 Unlock，goroutine 退出时 Go 会销毁这个线程，不需要再切换回原来的 namespace
+func startInNamespaces(cmd *exec.Cmd, paths map[int]string) error {
+	if len(paths) == 0 {
+		return cmd.Start()
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		for nstype, p := range paths {
+			if err := setns(p, nstype); err != nil {
+				errCh <- err
+				return
+			}
+		}
+		errCh <- cmd.Start()
+	}()
+	return <-errCh
+}
+
+func setns(path string, nstype int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = unix.Setns(int(file.Fd()), nstype); err != nil {
+		return errors.Wrapf(err, "setns %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package container
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseTimeOffset(t *testing.T) {
+	offset, err := ParseTimeOffset("boottime=24h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset.Clock != ClockBoottime || offset.Offset != 24*time.Hour {
+		t.Errorf("unexpected offset %+v", offset)
+	}
+	for _, val := range []string{"boottime", "realtime=1h", "monotonic=1x"} {
+		if _, err = ParseTimeOffset(val); err == nil {
+			t.Errorf("ParseTimeOffset(%s) expected error", val)
+		}
+	}
+	// 负数偏移的纳秒部分需要借位
+	n := &Namespaces{TimeOffsets: []*TimeOffset{
+		{Clock: ClockMonotonic, Offset: -1500 * time.Millisecond},
+		{Clock: ClockBoottime, Offset: time.Hour},
+	}}
+	if got := n.timensOffsets(); got != "monotonic -2 500000000\nboottime 3600 0\n" {
+		t.Errorf("timensOffsets() = %q", got)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	n := &Namespaces{}
+	if err := n.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	all := uintptr(syscall.CLONE_NEWNS | syscall.CLONE_NEWNET | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS)
+	if n.cloneFlags() != all || n.Shared() || !n.PrivateCgroupns() {
+		t.Errorf("unexpected default namespaces, flags %x", n.cloneFlags())
+	}
+
+	n = &Namespaces{Pid: NamespaceHost, Ipc: "container:db", Uts: NamespaceHost, Cgroupns: NamespaceHost}
+	if err := n.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if n.cloneFlags() != syscall.CLONE_NEWNS|syscall.CLONE_NEWNET || !n.Shared() || n.PrivateCgroupns() {
+		t.Errorf("unexpected shared namespaces, flags %x", n.cloneFlags())
+	}
+	// shareable 的容器仍然创建自己的 ipc namespace
+	if n = (&Namespaces{Ipc: NamespaceShareable}); n.cloneFlags()&syscall.CLONE_NEWIPC == 0 || n.Shared() {
+		t.Error("shareable ipc namespace should be private")
+	}
+
+	for _, n = range []*Namespaces{{Pid: "private"}, {Ipc: "container:"}, {Uts: "private"}, {Cgroupns: "shareable"}} {
+		if err := n.Validate(); err == nil {
+			t.Errorf("Validate(%+v) expected error", n)
+		}
+	}
+}
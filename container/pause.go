@@ -0,0 +1,69 @@
+package container
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"runQ/cgroups"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+)
+
+// 暂停和恢复容器的事件类型
+const (
+	EventPause   = "pause"
+	EventUnpause = "unpause"
+)
+
+// PauseContainer 通过 freezer 冻结容器中的所有进程，进程不会收到任何信号，内存中的状态保持不变
+func PauseContainer(containerName string) error {
+	containerInfo, err := GetContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+	switch containerInfo.Status {
+	case constant.RUNNING:
+	case constant.PAUSED:
+		return fmt.Errorf("container %s is already paused", containerName)
+	default:
+		return fmt.Errorf("container %s is not running", containerName)
+	}
+	if err = freezeContainer(containerInfo, resource.Frozen); err != nil {
+		return err
+	}
+	containerInfo.Status = constant.PAUSED
+	if err = UpdateContainerInfo(containerInfo); err != nil {
+		return err
+	}
+	RecordEvent(EventPause, containerInfo, nil)
+	return nil
+}
+
+// UnpauseContainer 解冻容器中的所有进程
+func UnpauseContainer(containerName string) error {
+	containerInfo, err := GetContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+	if containerInfo.Status != constant.PAUSED {
+		return fmt.Errorf("container %s is not paused", containerName)
+	}
+	if err = freezeContainer(containerInfo, resource.Thawed); err != nil {
+		return err
+	}
+	containerInfo.Status = constant.RUNNING
+	if err = UpdateContainerInfo(containerInfo); err != nil {
+		return err
+	}
+	RecordEvent(EventUnpause, containerInfo, nil)
+	return nil
+}
+
+func freezeContainer(containerInfo *ContainerInfo, state resource.FreezerState) error {
+	if containerInfo.CgroupPath == "" {
+		return fmt.Errorf("container %s has no cgroup", containerInfo.Id)
+	}
+	if err := cgroups.NewCgroupManager(containerInfo.CgroupPath).Freeze(state); err != nil {
+		return errors.WithMessagef(err, "set container %s freezer state %s", containerInfo.Id, state)
+	}
+	return nil
+}
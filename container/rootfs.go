@@ -1,7 +1,11 @@
 package container
 
 import (
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"os"
+	"path"
+	"runQ/constant"
 	"runQ/utils"
 )
 
@@ -24,9 +28,23 @@ import (
 //	}
 //}
 
-func NewWorkSpace(containerId, imageName, volume string) {
+// NewWorkSpace 创建容器的 rootfs，使用 user namespace 时需要在挂载 overlay 之前转换镜像文件的属主
+func NewWorkSpace(containerId, imageName, volume string, uidMaps, gidMaps []IDMap) error {
 	createLower(containerId, imageName)
 	createDirs(containerId)
+	// rootless 模式下镜像文件本来就属于当前用户，overlay 和数据卷由 init 进程挂载
+	if constant.Rootless {
+		return nil
+	}
+	if len(uidMaps) > 0 {
+		if err := remapRootfs(utils.GetLower(containerId), utils.GetUpper(containerId), utils.GetWorker(containerId),
+			uidMaps, gidMaps); err != nil {
+			return err
+		}
+		if err := makeTraversable(utils.GetMerged(containerId)); err != nil {
+			return errors.Wrap(err, "make rootfs traversable")
+		}
+	}
 	mountOverlayFS(containerId)
 
 	if volume != "" {
@@ -34,14 +52,21 @@ func NewWorkSpace(containerId, imageName, volume string) {
 		hostPath, containerPath, err := volumeExtract(volume)
 		if err != nil {
 			log.Errorf("extract volume failed，maybe volume parameter input is not correct，detail:%v", err)
-			return
+			return nil
 		}
 		mountVolume(mntPath, hostPath, containerPath)
 	}
-
+	return nil
 }
 
 func DeleteWorkSpace(containerId string, volume string) {
+	if constant.Rootless {
+		// overlay 和数据卷挂载在容器的 mount namespace 中，容器退出后自动卸载，宿主机上直接删除目录即可
+		// overlay 在 workdir 中创建的 work 目录权限为 000，普通用户需要先修改权限才能删除
+		_ = os.Chmod(path.Join(utils.GetWorker(containerId), "work"), constant.Perm0755)
+		deleteDirs(containerId)
+		return
+	}
 	// 如果指定了volume则需要umount volume
 	// NOTE: 一定要要先 umount volume ，然后再删除目录，
 	// 否则由于 bind mount 存在，删除临时目录会导致 volume 目录中的数据丢失。
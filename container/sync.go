@@ -0,0 +1,74 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// syncFdIndex 子进程向父进程报告初始化结果的管道，fd 3 为父进程发送 InitConfig 的管道
+const syncFdIndex = 4
+
+type syncType string
+
+const (
+	syncReady syncType = "ready" // 初始化完成，即将 execve 用户命令
+	syncError syncType = "error" // 初始化失败，或者 execve 失败
+)
+
+// syncMessage 子进程通过 sync pipe 发送给父进程的消息，每条消息为一个 JSON 对象
+type syncMessage struct {
+	Type  syncType `json:"type"`
+	Error string   `json:"error,omitempty"`
+}
+
+// InitError 容器 init 进程报告的初始化错误
+type InitError struct {
+	Message string
+}
+
+func (e *InitError) Error() string {
+	return fmt.Sprintf("container init failed: %s", e.Message)
+}
+
+// newSyncPipe 打开子进程中的 sync pipe，并设置 CLOEXEC，execve 成功后管道自动关闭，父进程读到 EOF
+func newSyncPipe() *os.File {
+	syscall.CloseOnExec(syncFdIndex)
+	return os.NewFile(uintptr(syncFdIndex), "sync")
+}
+
+func writeSync(pipe *os.File, msg *syncMessage) error {
+	return json.NewEncoder(pipe).Encode(msg)
+}
+
+// WaitInitReady 父进程一直读取 sync pipe 直到 EOF，EOF 说明子进程已经 execve 成功或者已经退出
+// 只有收到 ready 且没有收到 error 才表示容器启动成功，ready 之后 execve 失败时子进程还会再发送 error
+func WaitInitReady(syncPipe *os.File) error {
+	defer syncPipe.Close()
+	decoder := json.NewDecoder(syncPipe)
+	ready := false
+	for {
+		msg := new(syncMessage)
+		err := decoder.Decode(msg)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.Wrap(err, "read sync pipe")
+		}
+		switch msg.Type {
+		case syncReady:
+			ready = true
+		case syncError:
+			return &InitError{Message: msg.Error}
+		default:
+			return fmt.Errorf("unknown sync message type %s", msg.Type)
+		}
+	}
+	if !ready {
+		return &InitError{Message: "init process exited without reporting ready"}
+	}
+	return nil
+}
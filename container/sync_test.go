@@ -0,0 +1,44 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestWaitInitReady(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []*syncMessage
+		wantErr  bool
+	}{
+		{name: "ready", messages: []*syncMessage{{Type: syncReady}}},
+		{name: "error", messages: []*syncMessage{{Type: syncError, Error: "mount proc"}}, wantErr: true},
+		// ready 之后 execve 失败
+		{name: "exec failed", messages: []*syncMessage{{Type: syncReady}, {Type: syncError, Error: "exec"}}, wantErr: true},
+		// 子进程没有发送任何消息就退出
+		{name: "exited", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			readPipe, writePipe, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, msg := range test.messages {
+				if err = writeSync(writePipe, msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_ = writePipe.Close()
+			err = WaitInitReady(readPipe)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("WaitInitReady() error = %v, wantErr %v", err, test.wantErr)
+			}
+			var initErr *InitError
+			if err != nil && !errors.As(err, &initErr) {
+				t.Errorf("error %v is not an InitError", err)
+			}
+		})
+	}
+}
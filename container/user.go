@@ -0,0 +1,168 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	passwdFile  = "/etc/passwd"
+	groupFile   = "/etc/group"
+	defaultHome = "/"
+)
+
+// ExecUser 解析后的用户，容器进程以该用户运行
+type ExecUser struct {
+	Uid   int
+	Gid   int
+	Sgids []int // 附加组
+	Home  string
+}
+
+// passwdEntry /etc/passwd 中的一行，name:password:uid:gid:gecos:home:shell
+type passwdEntry struct {
+	name string
+	uid  int
+	gid  int
+	home string
+}
+
+// groupEntry /etc/group 中的一行，name:password:gid:user1,user2
+type groupEntry struct {
+	name    string
+	gid     int
+	members []string
+}
+
+// LookupUser 根据 rootfs 中的 /etc/passwd 和 /etc/group 解析 --user，格式为 user[:group]，user 和 group 可以是名称或者数值
+// 数值的 uid 在 /etc/passwd 中不存在时仍然可以使用，此时 gid 为 0，HOME 为 /，名称不存在时报错
+// 附加组为 /etc/group 中成员包含该用户的组
+func LookupUser(rootfs, user string) (*ExecUser, error) {
+	if user == "" {
+		user = "0"
+	}
+	userStr, groupStr, hasGroup := strings.Cut(user, ":")
+	users, err := parsePasswd(filepath.Join(rootfs, passwdFile))
+	if err != nil {
+		return nil, err
+	}
+	groups, err := parseGroup(filepath.Join(rootfs, groupFile))
+	if err != nil {
+		return nil, err
+	}
+
+	execUser := &ExecUser{Home: defaultHome}
+	uid, uidErr := strconv.Atoi(userStr)
+	var entry *passwdEntry
+	for _, u := range users {
+		if (uidErr == nil && u.uid == uid) || (uidErr != nil && u.name == userStr) {
+			entry = u
+			break
+		}
+	}
+	switch {
+	case entry != nil:
+		execUser.Uid, execUser.Gid, execUser.Home = entry.uid, entry.gid, entry.home
+	case uidErr == nil:
+		execUser.Uid = uid
+	default:
+		return nil, fmt.Errorf("unable to find user %s: no matching entries in passwd file", userStr)
+	}
+	if uidErr == nil && uid < 0 {
+		return nil, fmt.Errorf("invalid uid %d", uid)
+	}
+
+	if hasGroup {
+		gid, gidErr := strconv.Atoi(groupStr)
+		found := gidErr == nil
+		for _, g := range groups {
+			if gidErr != nil && g.name == groupStr {
+				gid, found = g.gid, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unable to find group %s: no matching entries in group file", groupStr)
+		}
+		if gid < 0 {
+			return nil, fmt.Errorf("invalid gid %d", gid)
+		}
+		execUser.Gid = gid
+	}
+
+	if entry != nil {
+		for _, g := range groups {
+			for _, member := range g.members {
+				if member == entry.name && g.gid != execUser.Gid {
+					execUser.Sgids = append(execUser.Sgids, g.gid)
+					break
+				}
+			}
+		}
+	}
+	return execUser, nil
+}
+
+func parsePasswd(path string) ([]*passwdEntry, error) {
+	var users []*passwdEntry
+	err := parseColonFile(path, func(fields []string) {
+		if len(fields) < 6 {
+			return
+		}
+		uid, err1 := strconv.Atoi(fields[2])
+		gid, err2 := strconv.Atoi(fields[3])
+		if err1 != nil || err2 != nil {
+			return
+		}
+		home := fields[5]
+		if home == "" {
+			home = defaultHome
+		}
+		users = append(users, &passwdEntry{name: fields[0], uid: uid, gid: gid, home: home})
+	})
+	return users, err
+}
+
+func parseGroup(path string) ([]*groupEntry, error) {
+	var groups []*groupEntry
+	err := parseColonFile(path, func(fields []string) {
+		if len(fields) < 3 {
+			return
+		}
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return
+		}
+		group := &groupEntry{name: fields[0], gid: gid}
+		if len(fields) > 3 && fields[3] != "" {
+			group.members = strings.Split(fields[3], ",")
+		}
+		groups = append(groups, group)
+	})
+	return groups, err
+}
+
+// parseColonFile 逐行解析以冒号分隔的文件，文件不存在时(e.g. 精简的镜像)视为空文件，忽略空行和注释
+func parseColonFile(path string, parse func(fields []string)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "open %s", path)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parse(strings.Split(line, ":"))
+	}
+	return scanner.Err()
+}
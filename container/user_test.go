@@ -0,0 +1,48 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLookupUser(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	passwd := "root:x:0:0:root:/root:/bin/sh\n# comment\napp:x:1000:1000::/home/app:/bin/sh\n"
+	group := "root:x:0:\napp:x:1000:\nstaff:x:50:app,other\n"
+	if err := os.WriteFile(filepath.Join(rootfs, passwdFile), []byte(passwd), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootfs, groupFile), []byte(group), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		user    string
+		want    *ExecUser
+		wantErr bool
+	}{
+		{user: "", want: &ExecUser{Uid: 0, Gid: 0, Home: "/root"}},
+		{user: "app", want: &ExecUser{Uid: 1000, Gid: 1000, Sgids: []int{50}, Home: "/home/app"}},
+		{user: "1000:staff", want: &ExecUser{Uid: 1000, Gid: 50, Home: "/home/app"}},
+		{user: "app:2000", want: &ExecUser{Uid: 1000, Gid: 2000, Sgids: []int{50}, Home: "/home/app"}},
+		// passwd 中不存在的 uid
+		{user: "4242", want: &ExecUser{Uid: 4242, Gid: 0, Home: "/"}},
+		{user: "nobody", wantErr: true},
+		{user: "app:nogroup", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.user, func(t *testing.T) {
+			user, err := LookupUser(rootfs, test.user)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("LookupUser() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(user, test.want) {
+				t.Errorf("LookupUser() = %+v, expected %+v", user, test.want)
+			}
+		})
+	}
+}
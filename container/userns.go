@@ -0,0 +1,174 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runQ/utils"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	subuidFile = "/etc/subuid"
+	subgidFile = "/etc/subgid"
+)
+
+// IDMap user namespace 中的 uid/gid 映射，容器中的 [ContainerID, ContainerID+Size) 映射到宿主机的 [HostID, HostID+Size)
+type IDMap struct {
+	ContainerID int `json:"containerId"`
+	HostID      int `json:"hostId"`
+	Size        int `json:"size"`
+}
+
+// LookupSubIDs 根据 /etc/subuid 和 /etc/subgid 生成 --userns-remap 的映射，容器中的 root 映射到宿主机上分配给该用户的第一个 id
+// remapUser 可以是用户名或者 uid，文件中使用哪一种都可以匹配
+func LookupSubIDs(remapUser string) ([]IDMap, []IDMap, error) {
+	names := []string{remapUser}
+	if u, err := user.Lookup(remapUser); err == nil {
+		names = append(names, u.Uid)
+	} else if u, err := user.LookupId(remapUser); err == nil {
+		names = append(names, u.Username)
+	}
+	uidMaps, err := parseSubIDs(subuidFile, names)
+	if err != nil {
+		return nil, nil, err
+	}
+	gidMaps, err := parseSubIDs(subgidFile, names)
+	if err != nil {
+		return nil, nil, err
+	}
+	return uidMaps, gidMaps, nil
+}
+
+// parseSubIDs 解析 name:start:count 格式的文件，同一个用户有多个范围时按顺序依次映射
+func parseSubIDs(path string, names []string) ([]IDMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open %s", path)
+	}
+	defer f.Close()
+	var maps []IDMap
+	containerID := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ":")
+		if len(fields) != 3 || !contains(names, fields[0]) {
+			continue
+		}
+		start, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil || start < 0 || count <= 0 {
+			return nil, fmt.Errorf("invalid range %s in %s", scanner.Text(), path)
+		}
+		maps = append(maps, IDMap{ContainerID: containerID, HostID: start, Size: count})
+		containerID += count
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "read %s", path)
+	}
+	if len(maps) == 0 {
+		return nil, fmt.Errorf("no subordinate ids for user %s in %s", names[0], path)
+	}
+	return maps, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// toHostID 将容器中的 id 转换为宿主机上的 id
+func toHostID(id int, maps []IDMap) (int, error) {
+	for _, m := range maps {
+		if id >= m.ContainerID && id < m.ContainerID+m.Size {
+			return m.HostID + id - m.ContainerID, nil
+		}
+	}
+	return -1, fmt.Errorf("id %d is not mapped", id)
+}
+
+func toSysProcIDMaps(maps []IDMap) []syscall.SysProcIDMap {
+	var result []syscall.SysProcIDMap
+	for _, m := range maps {
+		result = append(result, syscall.SysProcIDMap{ContainerID: m.ContainerID, HostID: m.HostID, Size: m.Size})
+	}
+	return result
+}
+
+// remapRootfs 将镜像文件的属主转换为映射后的宿主机 id，否则容器中的 root 看到的文件都属于 nobody
+// upper 和 work 目录属于映射后的 root，容器中的 root 才能修改根目录
+func remapRootfs(lower, upper, work string, uidMaps, gidMaps []IDMap) error {
+	err := filepath.Walk(lower, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		stat := info.Sys().(*syscall.Stat_t)
+		return lchownMapped(path, int(stat.Uid), int(stat.Gid), uidMaps, gidMaps)
+	})
+	if err != nil {
+		return errors.Wrap(err, "remap lower dir")
+	}
+	for _, dir := range []string{upper, work} {
+		if err = lchownMapped(dir, 0, 0, uidMaps, gidMaps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lchownMapped(path string, uid, gid int, uidMaps, gidMaps []IDMap) error {
+	hostUid, err := toHostID(uid, uidMaps)
+	if err != nil {
+		return errors.WithMessagef(err, "remap owner of %s", path)
+	}
+	hostGid, err := toHostID(gid, gidMaps)
+	if err != nil {
+		return errors.WithMessagef(err, "remap group of %s", path)
+	}
+	// chown 会清除 setuid/setgid 位，需要恢复原来的权限
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if err = os.Lchown(path, hostUid, hostGid); err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 && info.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 {
+		return os.Chmod(path, info.Mode())
+	}
+	return nil
+}
+
+// makeTraversable 映射后的 root 在宿主机上是普通用户，需要能够进入 runQ 目录下容器的 rootfs
+func makeTraversable(dir string) error {
+	// 只修改 runQ 自己的目录，e.g. /var/lib/runQ
+	runtimeRoot := filepath.Dir(filepath.Clean(utils.RootPath()))
+	for ; strings.HasPrefix(dir, runtimeRoot); dir = filepath.Dir(dir) {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if info.Mode().Perm()&0o001 == 0 {
+			if err = os.Chmod(dir, info.Mode().Perm()|0o111); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RootlessIDMaps rootless 模式下普通用户只能把自己的 uid/gid 映射为容器中的 root
+func RootlessIDMaps() (uidMaps, gidMaps []IDMap) {
+	uidMaps = []IDMap{{ContainerID: 0, HostID: os.Geteuid(), Size: 1}}
+	gidMaps = []IDMap{{ContainerID: 0, HostID: os.Getegid(), Size: 1}}
+	return uidMaps, gidMaps
+}
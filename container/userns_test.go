@@ -0,0 +1,38 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSubIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subuid")
+	content := "other:200000:65536\nrunQ:100000:65536\n1000:300000:1000\nrunQ:400000:10\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	maps, err := parseSubIDs(path, []string{"runQ", "1000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 多个范围按顺序依次映射到容器中
+	expected := []IDMap{
+		{ContainerID: 0, HostID: 100000, Size: 65536},
+		{ContainerID: 65536, HostID: 300000, Size: 1000},
+		{ContainerID: 66536, HostID: 400000, Size: 10},
+	}
+	if !reflect.DeepEqual(maps, expected) {
+		t.Errorf("parseSubIDs() = %+v, expected %+v", maps, expected)
+	}
+	if id, err := toHostID(65537, maps); err != nil || id != 300001 {
+		t.Errorf("toHostID(65537) = %d, %v, expected 300001", id, err)
+	}
+	if _, err = toHostID(70000, maps); err == nil {
+		t.Errorf("toHostID(70000) expected error")
+	}
+	if _, err = parseSubIDs(path, []string{"nobody"}); err == nil {
+		t.Errorf("parseSubIDs() expected error for user without subordinate ids")
+	}
+}
@@ -2,12 +2,14 @@ package container
 
 import (
 	"fmt"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"os"
 	"os/exec"
 	"path"
 	"runQ/constant"
 	"strings"
+	"syscall"
 )
 
 func mountVolume(mntPath string, hostPath string, containerPath string) {
@@ -35,6 +37,19 @@ func mountVolume(mntPath string, hostPath string, containerPath string) {
 	}
 }
 
+// VolumeMount rootless 模式下数据卷由 init 进程在 pivot_root 之前 bind mount 到 rootfs 中
+func VolumeMount(volume string) (*Mount, error) {
+	hostPath, containerPath, err := volumeExtract(volume)
+	if err != nil {
+		return nil, err
+	}
+	// 如果主机的目录不存在则自动创建
+	if err = os.MkdirAll(hostPath, constant.Perm0777); err != nil {
+		return nil, errors.Wrapf(err, "mkdir volume %s", hostPath)
+	}
+	return &Mount{Source: hostPath, Destination: containerPath, Device: "bind", Flags: syscall.MS_BIND | syscall.MS_REC}, nil
+}
+
 func umountVolume(mntPath, containerPath string) {
 	containerPathInHost := path.Join(mntPath, containerPath)
 	cmd := exec.Command("umount", containerPathInHost)
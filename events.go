@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli"
+	"runQ/container"
+)
+
+var eventsCommand = cli.Command{
+	Name:  "events",
+	Usage: "show container events, e.g. runQ events --name 1234567890",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "name,n", Usage: "only show events of the container"},
+		cli.StringFlag{Name: "format", Usage: "output format, text or json"},
+	},
+	Action: func(ctx *cli.Context) error {
+		format := ctx.String("format")
+		if format != "" && format != "text" && format != "json" {
+			return fmt.Errorf("unsupported format %s, must be text or json", format)
+		}
+		events, err := container.ListEvents(ctx.String("name"))
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if format != "json" {
+				fmt.Println(event)
+				continue
+			}
+			content, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(content))
+		}
+		return nil
+	},
+}
+
+var monitorCommand = cli.Command{
+	Name:   "monitor",
+	Usage:  `Monitor a detached container and record its exit status. Do not call it outside`,
+	Hidden: true,
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("missing container id")
+		}
+		return container.MonitorContainer(ctx.Args().Get(0))
+	},
+}
@@ -1,28 +1,33 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"os"
 	"os/exec"
-	"path"
+	"runQ/cgroups"
 	"runQ/constant"
 	"runQ/container"
 	_ "runQ/nsenter"
+	"strconv"
 	"strings"
 )
 
-func ExecContainer(containerName string, comArray []string) {
+func ExecContainer(containerName string, comArray []string, user string) {
 
-	containerId := container.GetContainerIdByName(containerName)
-
-	pid, err := GetPidByContainerId(containerId)
-	fmt.Println("pid>", pid)
+	containerInfo, err := container.GetContainerInfoByName(containerName)
 	if err != nil {
-		log.Errorf("Exec container getContainerPidByName %s error %v", containerId, err)
+		log.Errorf("Exec container getContainerInfoByName %s error %v", containerName, err)
+		return
+	}
+	// 被冻结的容器中无法运行新的进程，exec 进程加入 cgroup 后也会被冻结
+	if containerInfo.Status == constant.PAUSED {
+		log.Errorf("Container %s is paused, unpause the container before exec", containerName)
 		return
 	}
+	containerId := containerInfo.Id
+	pid := containerInfo.Pid
+	fmt.Println("pid>", pid)
 	//fmt.Println("cmdArray>", comArray)
 	// cmdArray> [/bin/sh]
 	cmd := exec.Command(constant.EXECSELF, "exec")
@@ -32,32 +37,46 @@ func ExecContainer(containerName string, comArray []string) {
 
 	cmdStr := strings.Join(comArray, " ")
 	log.Infof("container pid: %s command: %s", pid, cmdStr)
+	// 进入 user namespace 后宿主机的 root 在容器中没有映射，没有指定用户时也需要切换为容器中的 root
+	if len(containerInfo.UidMappings) > 0 {
+		if user == "" {
+			user = "0"
+		}
+	}
+	// 通过 /proc/{pid}/root 访问容器的根文件系统，使用容器中的 /etc/passwd 解析用户
+	if user != "" {
+		execUser, err := container.LookupUser(fmt.Sprintf("/proc/%s/root", pid), user)
+		if err != nil {
+			log.Errorf("Exec container %s lookup user %s error %v", containerName, user, err)
+			return
+		}
+		container.SetExecUserENV(execUser)
+	}
+	// exec 的进程与容器的 init 进程一样只保留容器的 capability，并安装 run 时编译好的 seccomp 过滤程序
+	if err = container.SetExecSecurityENV(containerInfo.Capabilities, containerInfo.SeccompProgram); err != nil {
+		log.Errorf("Exec container %s set capabilities error %v", containerName, err)
+		return
+	}
 	_ = os.Setenv(container.EnvExecPid, pid)
 	_ = os.Setenv(container.EnvExecCmd, cmdStr)
 	// 把指定PID进程的环境变量传递给新启动的进程，实现通过exec命令也能查询到容器的环境变量
 	containerEnvs := GetEnvsByPid(pid)
 	cmd.Env = append(os.Environ(), containerEnvs...)
+	// 只有 exec 的子进程加入容器的 cgroup，由 nsenter 在 system() 之前加入，宿主机上的 runQ exec 进程不受容器资源限制的影响
+	if containerInfo.CgroupPath != "" {
+		initPid, err := strconv.Atoi(pid)
+		if err != nil {
+			log.Errorf("Exec container %s invalid pid %s", containerName, pid)
+			return
+		}
+		procsFiles := cgroups.NewCgroupManager(containerInfo.CgroupPath).ProcsFiles(initPid)
+		cmd.Env = append(cmd.Env, container.EnvExecCgroupProcs+"="+strings.Join(procsFiles, ":"))
+	}
 	if err = cmd.Run(); err != nil {
 		log.Errorf("Exec container %s error %v", containerId, err)
 	}
 }
 
-func GetPidByContainerId(containerId string) (string, error) {
-	dirPath := fmt.Sprintf(constant.InfoLocFormat, containerId)
-
-	configFilePath := path.Join(dirPath, constant.ConfigName)
-	fmt.Println("configFilePath>", configFilePath)
-	contentBytes, err := os.ReadFile(configFilePath)
-	if err != nil {
-		return "", err
-	}
-	var containerInfo container.ContainerInfo
-	if err = json.Unmarshal(contentBytes, &containerInfo); err != nil {
-		return "", err
-	}
-	return containerInfo.Pid, nil
-}
-
 func GetEnvsByPid(pid string) []string {
 	EnvsPath := fmt.Sprintf("/proc/%s/environ", pid)
 	contentBytes, err := os.ReadFile(EnvsPath)
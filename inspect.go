@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"runQ/cgroups"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+	"runQ/container"
+)
+
+var inspectCommand = cli.Command{
+	Name:  "inspect",
+	Usage: "display detailed information of a container, e.g. runQ inspect 1234567890",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("please input your container name")
+		}
+		return inspectContainer(ctx.Args().Get(0))
+	},
+}
+
+// containerInspect inspect 的输出，在容器信息的基础上附加从 cgroup 中实时读取的资源使用情况
+type containerInspect struct {
+	*container.ContainerInfo
+	Stats *resource.Stats `json:"stats,omitempty"`
+}
+
+func inspectContainer(containerName string) error {
+	containerInfo, err := container.GetContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+	inspect := &containerInspect{ContainerInfo: containerInfo}
+	if (containerInfo.Status == constant.RUNNING || containerInfo.Status == constant.PAUSED) && containerInfo.CgroupPath != "" {
+		stats, err := cgroups.NewCgroupManager(containerInfo.CgroupPath).GetStats()
+		if err != nil {
+			log.Warnf("get container %s stats error %v", containerInfo.Id, err)
+		}
+		inspect.Stats = stats
+	}
+	content, err := json.MarshalIndent(inspect, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(content))
+	return nil
+}
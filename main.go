@@ -1,9 +1,11 @@
 package main
 
 import (
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 	"os"
+	"runQ/constant"
 	_ "runQ/nsenter"
 )
 
@@ -16,19 +18,37 @@ func main() {
 
 	app.Commands = []cli.Command{
 		initCommand,
+		monitorCommand,
 		runCommand,
 		exportCommand,
 		listCommand,
+		inspectCommand,
+		statsCommand,
+		updateCommand,
+		eventsCommand,
 		logCommand,
 		execCommand,
+		pauseCommand,
+		unpauseCommand,
 		stopCommand,
 		removeCommand,
 		networkCommand,
 	}
 
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{
+			Name:   "rootless",
+			Usage:  "run containers as an unprivileged user, enabled automatically when runQ is not run by root",
+			EnvVar: constant.EnvRootless,
+		},
+	}
+
 	app.Before = func(context *cli.Context) error {
 		log.SetFormatter(&log.JSONFormatter{})
 		log.SetOutput(os.Stdout)
+		if context.GlobalBool("rootless") || os.Geteuid() != 0 {
+			return setupRootless()
+		}
 		return nil
 	}
 
@@ -36,3 +56,17 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// setupRootless 进入 rootless 模式，状态目录改为 $XDG_RUNTIME_DIR/runQ
+// 通过环境变量传递给 monitor 等子进程，使它们使用同一个状态目录
+func setupRootless() error {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return fmt.Errorf("XDG_RUNTIME_DIR must be set in rootless mode")
+	}
+	if err := os.Setenv(constant.EnvRootless, "1"); err != nil {
+		return err
+	}
+	constant.SetupRootless(runtimeDir)
+	return nil
+}
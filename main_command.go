@@ -2,23 +2,61 @@ package main
 
 import (
 	"fmt"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"net"
 	"os"
+	"runQ/cgroups"
 	"runQ/cgroups/resource"
+	"runQ/constant"
 	"runQ/container"
+	"runQ/seccomp"
+	"runQ/utils"
+	"runtime"
+	"strings"
 )
 
+const (
+	seccompDefault    = "default"
+	seccompUnconfined = "unconfined"
+)
+
+// resourceFlags 容器资源限制相关的参数
+var resourceFlags = []cli.Flag{
+	cli.StringFlag{Name: "mem,memory", Usage: "memory limit,e.g.: -mem 100m"},
+	cli.StringFlag{Name: "memory-swap", Usage: "total limit of memory plus swap, -1 for unlimited swap,e.g.: --memory-swap 200m"},
+	cli.StringFlag{Name: "memory-reservation", Usage: "memory soft limit,e.g.: --memory-reservation 50m"},
+	cli.Int64Flag{Name: "memory-swappiness", Usage: "tune container memory swappiness (0 to 100)", Value: -1},
+	cli.BoolFlag{Name: "oom-kill-disable", Usage: "disable OOM killer"},
+	cli.StringFlag{Name: "kernel-memory", Usage: "kernel memory limit (cgroup v1 only),e.g.: --kernel-memory 50m"},
+	cli.StringFlag{Name: "kernel-memory-tcp", Usage: "kernel TCP buffer memory limit (cgroup v1 only),e.g.: --kernel-memory-tcp 10m"},
+	cli.IntFlag{Name: "cpu", Usage: "cpu quota in percent of one cpu,e.g.: -cpu 100"},
+	cli.Float64Flag{Name: "cpus", Usage: "number of cpus,e.g.: --cpus 1.5"},
+	cli.Uint64Flag{Name: "cpu-shares", Usage: "cpu shares (relative weight),e.g.: --cpu-shares 512"},
+	cli.Uint64Flag{Name: "cpu-period", Usage: "limit cpu CFS period in microseconds,e.g.: --cpu-period 100000"},
+	cli.Int64Flag{Name: "cpu-quota", Usage: "limit cpu CFS quota in microseconds,e.g.: --cpu-quota 50000"},
+	cli.StringFlag{Name: "cpuset,cpuset-cpus", Usage: "cpuset limit,e.g.: -cpuset 2,4"},
+	cli.StringFlag{Name: "cpuset-mems", Usage: "memory nodes (NUMA) allowed to use,e.g.: --cpuset-mems 0,1"},
+	cli.Int64Flag{Name: "pids-limit", Usage: "max number of processes in container, -1 for unlimited,e.g.: --pids-limit 100"},
+	cli.UintFlag{Name: "blkio-weight", Usage: "block IO weight, between 10 and 1000,e.g.: --blkio-weight 500"},
+	cli.StringSliceFlag{Name: "blkio-weight-device", Usage: "block IO weight of a device,e.g.: --blkio-weight-device /dev/sda:200"},
+	cli.StringSliceFlag{Name: "device-read-bps", Usage: "limit read rate from a device,e.g.: --device-read-bps /dev/sda:10mb"},
+	cli.StringSliceFlag{Name: "device-write-bps", Usage: "limit write rate to a device,e.g.: --device-write-bps /dev/sda:10mb"},
+	cli.StringSliceFlag{Name: "device-read-iops", Usage: "limit read rate (IO per second) from a device,e.g.: --device-read-iops /dev/sda:1000"},
+	cli.StringSliceFlag{Name: "device-write-iops", Usage: "limit write rate (IO per second) to a device,e.g.: --device-write-iops /dev/sda:1000"},
+	cli.StringSliceFlag{Name: "device-cgroup-rule", Usage: "add a rule to the cgroup allowed devices list,e.g.: --device-cgroup-rule 'c 1:1 rwm'"},
+	cli.StringSliceFlag{Name: "hugepages", Usage: "limit number of hugepages of a page size,e.g.: --hugepages 2MB:100"},
+}
+
 var runCommand = cli.Command{
 	Name: "run",
 	Usage: `Create a container with namespace and cgroups limit
 			runQ run -it [command]`,
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		cli.BoolFlag{Name: "it", Usage: "enable tty"},
 		cli.BoolFlag{Name: "d", Usage: "detach container"},
-		cli.StringFlag{Name: "mem", Usage: "memory limit,e.g.: -mem 100m"},
-		cli.StringFlag{Name: "cpu", Usage: "cpu quota,e.g.: -cpu 100"},
-		cli.StringFlag{Name: "cpuset", Usage: "cpuset limit,e.g.: -cpuset 2,4"},
+		cli.StringFlag{Name: "cgroup-parent", Usage: "parent cgroup of the container,e.g.: -cgroup-parent runQ", Value: cgroups.DefaultParent},
 		cli.StringFlag{Name: "v", Usage: "volume,e.g.: -v /etc/conf:/etc/conf"},
 		cli.StringFlag{Name: "name,n", Usage: "container name"},
 		cli.StringFlag{Name: "image,i", Usage: "container image"},
@@ -28,7 +66,30 @@ var runCommand = cli.Command{
 			Name:  "p",
 			Usage: "port mapping,e.g. -p 8080:80 -p 30336:3306",
 		},
-	},
+		cli.StringFlag{Name: "shm-size", Usage: "size of /dev/shm, default 64m,e.g.: --shm-size 128m"},
+		cli.StringSliceFlag{Name: "cap-add", Usage: "add linux capabilities, ALL for all capabilities,e.g.: --cap-add NET_ADMIN"},
+		cli.StringSliceFlag{Name: "cap-drop", Usage: "drop linux capabilities, ALL for all capabilities,e.g.: --cap-drop MKNOD"},
+		cli.BoolFlag{Name: "privileged", Usage: "give all capabilities and access to all devices to the container"},
+		cli.StringFlag{Name: "user,u", Usage: "username or uid and optional groupname or gid,e.g.: --user app:staff, --user 1000:1000"},
+		cli.StringFlag{Name: "userns-remap", Usage: "run the container in a user namespace, mapping root to the subordinate ids of the user in /etc/subuid and /etc/subgid,e.g.: --userns-remap runQ"},
+		cli.BoolFlag{Name: "read-only", Usage: "mount the container's root filesystem as read only"},
+		cli.StringSliceFlag{Name: "tmpfs", Usage: "mount a tmpfs directory,e.g.: --tmpfs /run:size=64m"},
+		cli.StringSliceFlag{Name: "security-opt", Usage: "security options,e.g.: --security-opt seccomp=profile.json, --security-opt seccomp=unconfined"},
+		cli.StringFlag{Name: "pid", Usage: "pid namespace to use, host or container:<name>,e.g.: --pid container:web"},
+		cli.StringFlag{Name: "ipc", Usage: "ipc namespace to use, private, shareable, host or container:<name>,e.g.: --ipc shareable"},
+		cli.StringFlag{Name: "uts", Usage: "uts namespace to use,e.g.: --uts host"},
+		cli.StringFlag{Name: "cgroupns", Usage: "cgroup namespace to use, private or host"},
+		cli.StringSliceFlag{Name: "time-offset", Usage: "run the container in a time namespace with the clock offset,e.g.: --time-offset boottime=24h"},
+		cli.StringFlag{Name: "hostname", Usage: "container hostname, defaults to the container id"},
+		cli.StringFlag{Name: "domainname", Usage: "container NIS domain name"},
+		cli.StringSliceFlag{Name: "add-host", Usage: "add a custom host-to-IP mapping to /etc/hosts,e.g.: --add-host db:10.0.0.2"},
+		cli.StringSliceFlag{Name: "dns", Usage: "set custom DNS servers,e.g.: --dns 8.8.8.8"},
+		cli.StringSliceFlag{Name: "dns-search", Usage: "set custom DNS search domains,e.g.: --dns-search example.com"},
+		cli.StringSliceFlag{Name: "dns-option", Usage: "set DNS options,e.g.: --dns-option ndots:2"},
+		cli.StringSliceFlag{Name: "ulimit", Usage: "set resource limits, -1 for unlimited,e.g.: --ulimit nofile=65536:65536"},
+		cli.StringSliceFlag{Name: "sysctl", Usage: "set namespaced kernel parameters,e.g.: --sysctl net.core.somaxconn=1024"},
+		cli.IntFlag{Name: "oom-score-adj", Usage: "tune the container's OOM score, from -1000 to 1000"},
+	}, resourceFlags...),
 	Action: func(ctx *cli.Context) error {
 		if len(ctx.Args()) < 1 {
 			return fmt.Errorf("missing container command")
@@ -38,20 +99,12 @@ var runCommand = cli.Command{
 		for _, arg := range ctx.Args() {
 			cmdArray = append(cmdArray, arg)
 		}
-		resConf := &resource.ResourceConfig{
-			MemoryLimit: ctx.String("mem"),
-			CpuSet:      ctx.String("cpuset"),
-			CpuCfsQuota: ctx.Int("cpu"),
+		resConf, err := parseResourceConfig(ctx)
+		if err != nil {
+			return err
 		}
-		imageNmae := ctx.String("image")
 		tty := ctx.Bool("it")
 		detach := ctx.Bool("d")
-		containerName := ctx.String("name")
-		envSlice := ctx.StringSlice("e")
-		volume := ctx.String("v")
-		network := ctx.String("net")
-		portMapping := ctx.StringSlice("p")
-
 		if tty && detach {
 			return fmt.Errorf("it and d paramter can not both provided")
 		}
@@ -59,11 +112,326 @@ var runCommand = cli.Command{
 			tty = true
 		}
 		log.Infof("createTTY %v", tty)
-		Run(tty, cmdArray, envSlice, resConf, volume, containerName, imageNmae, network, portMapping)
-		return nil
+		opts := &RunOptions{
+			Tty:          tty,
+			Cmd:          cmdArray,
+			Env:          ctx.StringSlice("e"),
+			Resource:     resConf,
+			Volume:       ctx.String("v"),
+			Name:         ctx.String("name"),
+			Image:        ctx.String("image"),
+			Network:      ctx.String("net"),
+			PortMapping:  ctx.StringSlice("p"),
+			CgroupParent: ctx.String("cgroup-parent"),
+			Privileged:   ctx.Bool("privileged"),
+			User:         ctx.String("user"),
+			Readonly:     ctx.Bool("read-only"),
+			Namespaces: &container.Namespaces{
+				Pid:      ctx.String("pid"),
+				Ipc:      ctx.String("ipc"),
+				Uts:      ctx.String("uts"),
+				Cgroupns: ctx.String("cgroupns"),
+			},
+			Hostname:   ctx.String("hostname"),
+			Domainname: ctx.String("domainname"),
+			ExtraHosts: ctx.StringSlice("add-host"),
+			DNS:        ctx.StringSlice("dns"),
+			DNSSearch:  ctx.StringSlice("dns-search"),
+			DNSOptions: ctx.StringSlice("dns-option"),
+		}
+		if err = opts.Namespaces.Validate(); err != nil {
+			return err
+		}
+		if err = validateEtcOptions(opts); err != nil {
+			return err
+		}
+		for _, val := range ctx.StringSlice("time-offset") {
+			offset, err := container.ParseTimeOffset(val)
+			if err != nil {
+				return err
+			}
+			opts.Namespaces.TimeOffsets = append(opts.Namespaces.TimeOffsets, offset)
+		}
+		if remapUser := ctx.String("userns-remap"); remapUser != "" {
+			// 普通用户没有权限写入 /etc/subuid 中的映射
+			if constant.Rootless {
+				return fmt.Errorf("userns-remap is not supported in rootless mode")
+			}
+			// 特权容器需要宿主机上的 root 权限，在 user namespace 中没有意义
+			if opts.Privileged {
+				return fmt.Errorf("privileged and userns-remap can not both provided")
+			}
+			if opts.UidMappings, opts.GidMappings, err = container.LookupSubIDs(remapUser); err != nil {
+				return err
+			}
+		} else if constant.Rootless {
+			// rootless 模式下总是先创建 user namespace，容器中的 root 映射为当前用户
+			opts.UidMappings, opts.GidMappings = container.RootlessIDMaps()
+		}
+		if len(opts.UidMappings) > 0 && opts.Namespaces.Shared() {
+			return fmt.Errorf("pid and ipc namespaces of the host or other containers can not be used with user namespaces")
+		}
+		if constant.Rootless && (opts.Network != "" || len(opts.PortMapping) > 0) {
+			// 普通用户不能创建 veth 和 iptables 规则，容器只能使用自己 network namespace 中的 loopback
+			log.Warnf("Network %s and port mapping are not supported in rootless mode, using loopback only", opts.Network)
+			opts.Network, opts.PortMapping = "", nil
+		}
+		if err = parseLimitOptions(ctx, opts); err != nil {
+			return err
+		}
+		for _, val := range ctx.StringSlice("tmpfs") {
+			tmpfs, err := container.ParseTmpfs(val)
+			if err != nil {
+				return err
+			}
+			opts.Tmpfs = append(opts.Tmpfs, tmpfs)
+		}
+		if opts.Capabilities, err = container.TweakCapabilities(ctx.StringSlice("cap-add"), ctx.StringSlice("cap-drop"),
+			opts.Privileged); err != nil {
+			return err
+		}
+		if opts.Privileged {
+			// 特权容器可以访问所有设备，--device-cgroup-rule 没有意义
+			resConf.Devices = []*resource.DeviceRule{resource.AllowAllDevices}
+		}
+		if err = parseSecurityOpt(ctx.StringSlice("security-opt"), opts); err != nil {
+			return err
+		}
+		if shmSize := ctx.String("shm-size"); shmSize != "" {
+			if opts.ShmSize, err = utils.RAMInBytes(shmSize); err != nil {
+				return fmt.Errorf("invalid shm-size %s: %v", shmSize, err)
+			}
+			if opts.ShmSize <= 0 {
+				return fmt.Errorf("shm-size must be greater than 0")
+			}
+		}
+		return Run(opts)
 	},
 }
 
+// validateEtcOptions 检查主机名、--add-host 和 --dns，使用宿主机的 uts namespace 时不能指定主机名
+func validateEtcOptions(opts *RunOptions) error {
+	if opts.Namespaces.Uts == container.NamespaceHost && (opts.Hostname != "" || opts.Domainname != "") {
+		return fmt.Errorf("hostname and domainname can not be used with --uts host")
+	}
+	for _, extraHost := range opts.ExtraHosts {
+		if _, _, err := container.ParseExtraHost(extraHost); err != nil {
+			return err
+		}
+	}
+	for _, dns := range opts.DNS {
+		if net.ParseIP(dns) == nil {
+			return fmt.Errorf("invalid dns %s, must be an ip address", dns)
+		}
+	}
+	return nil
+}
+
+// parseLimitOptions 解析 --ulimit、--sysctl 和 --oom-score-adj，sysctl 需要根据 ipc namespace 的模式检查
+func parseLimitOptions(ctx *cli.Context, opts *RunOptions) error {
+	for _, val := range ctx.StringSlice("ulimit") {
+		rlimit, err := container.ParseUlimit(val)
+		if err != nil {
+			return err
+		}
+		opts.Ulimits = append(opts.Ulimits, rlimit)
+	}
+	for _, val := range ctx.StringSlice("sysctl") {
+		key, value, ok := strings.Cut(val, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid sysctl %s, must be <key>=<value>", val)
+		}
+		if err := container.ValidateSysctl(key, opts.Namespaces); err != nil {
+			return err
+		}
+		if opts.Sysctls == nil {
+			opts.Sysctls = map[string]string{}
+		}
+		opts.Sysctls[key] = value
+	}
+	if ctx.IsSet("oom-score-adj") {
+		score := ctx.Int("oom-score-adj")
+		if score < -1000 || score > 1000 {
+			return fmt.Errorf("invalid oom-score-adj %d, must be between -1000 and 1000", score)
+		}
+		opts.OOMScoreAdj = &score
+	}
+	return nil
+}
+
+// parseSecurityOpt 解析 --security-opt，并根据容器最终的 capability 编译 seccomp profile
+// 没有指定 seccomp 时使用默认 profile，特权容器默认不过滤系统调用
+func parseSecurityOpt(securityOpts []string, opts *RunOptions) error {
+	profileName := seccompDefault
+	if opts.Privileged {
+		profileName = seccompUnconfined
+	}
+	for _, opt := range securityOpts {
+		key, value, ok := strings.Cut(opt, "=")
+		if !ok || key != "seccomp" || value == "" {
+			return fmt.Errorf("invalid security-opt %s, must be seccomp=<profile>", opt)
+		}
+		profileName = value
+	}
+	opts.SeccompProfile = profileName
+	var profile *seccomp.Profile
+	switch profileName {
+	case seccompUnconfined:
+		return nil
+	case seccompDefault:
+		profile = seccomp.DefaultProfile()
+	default:
+		var err error
+		if profile, err = seccomp.LoadProfile(profileName); err != nil {
+			return err
+		}
+	}
+	program, err := seccomp.Compile(profile, opts.Capabilities)
+	if err != nil {
+		return errors.WithMessage(err, "compile seccomp profile")
+	}
+	opts.Seccomp = program
+	return nil
+}
+
+// parseResourceConfig 从命令行参数中解析容器的资源限制
+func parseResourceConfig(ctx *cli.Context) (*resource.ResourceConfig, error) {
+	res, err := buildResourceConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res, res.Validate()
+}
+
+// buildResourceConfig 解析资源限制参数但不做整体校验，update 需要先和容器原有的限制合并后再校验
+func buildResourceConfig(ctx *cli.Context) (*resource.ResourceConfig, error) {
+	res := &resource.ResourceConfig{
+		OomKillDisable: ctx.Bool("oom-kill-disable"),
+		CpuShares:      ctx.Uint64("cpu-shares"),
+		CpuPeriod:      ctx.Uint64("cpu-period"),
+		CpuQuota:       ctx.Int64("cpu-quota"),
+		CpuSet:         ctx.String("cpuset"),
+		CpusetMems:     ctx.String("cpuset-mems"),
+		PidsLimit:      ctx.Int64("pids-limit"),
+	}
+	if err := parseMemory(ctx, res); err != nil {
+		return nil, err
+	}
+	if err := parseCpus(ctx, res); err != nil {
+		return nil, err
+	}
+	if weight := ctx.Uint("blkio-weight"); weight != 0 {
+		if weight < resource.BlkioWeightMin || weight > resource.BlkioWeightMax {
+			return nil, fmt.Errorf("invalid blkio weight %d, must be in range [%d, %d]", weight, resource.BlkioWeightMin, resource.BlkioWeightMax)
+		}
+		res.BlkioWeight = uint16(weight)
+	}
+	for _, val := range ctx.StringSlice("blkio-weight-device") {
+		wd, err := resource.ParseWeightDevice(val)
+		if err != nil {
+			return nil, err
+		}
+		res.BlkioWeightDevice = append(res.BlkioWeightDevice, wd)
+	}
+	throttles := []struct {
+		flag    string
+		parse   func(string) (*resource.ThrottleDevice, error)
+		devices *[]*resource.ThrottleDevice
+	}{
+		{"device-read-bps", resource.ParseThrottleBpsDevice, &res.BlkioThrottleReadBpsDevice},
+		{"device-write-bps", resource.ParseThrottleBpsDevice, &res.BlkioThrottleWriteBpsDevice},
+		{"device-read-iops", resource.ParseThrottleIOpsDevice, &res.BlkioThrottleReadIOPSDevice},
+		{"device-write-iops", resource.ParseThrottleIOpsDevice, &res.BlkioThrottleWriteIOPSDevice},
+	}
+	for _, throttle := range throttles {
+		for _, val := range ctx.StringSlice(throttle.flag) {
+			td, err := throttle.parse(val)
+			if err != nil {
+				return nil, err
+			}
+			*throttle.devices = append(*throttle.devices, td)
+		}
+	}
+	// 容器默认只能访问白名单中的设备
+	res.Devices = append([]*resource.DeviceRule{}, resource.DefaultDeviceRules...)
+	for _, val := range ctx.StringSlice("device-cgroup-rule") {
+		rule, err := resource.ParseDeviceCgroupRule(val)
+		if err != nil {
+			return nil, err
+		}
+		res.Devices = append(res.Devices, rule)
+	}
+	for _, val := range ctx.StringSlice("hugepages") {
+		limit, err := resource.ParseHugepageLimit(val)
+		if err != nil {
+			return nil, err
+		}
+		res.HugetlbLimit = append(res.HugetlbLimit, limit)
+	}
+	return res, nil
+}
+
+// parseMemory 将 100m 这样的内存大小字符串换算为字节数，-1 表示不限制
+func parseMemory(ctx *cli.Context, res *resource.ResourceConfig) error {
+	sizes := []struct {
+		flag  string
+		value *int64
+	}{
+		{"mem", &res.Memory},
+		{"memory-swap", &res.MemorySwap},
+		{"memory-reservation", &res.MemoryReservation},
+		{"kernel-memory", &res.KernelMemory},
+		{"kernel-memory-tcp", &res.KernelMemoryTCP},
+	}
+	for _, size := range sizes {
+		val := ctx.String(size.flag)
+		if val == "" {
+			continue
+		}
+		if val == "-1" {
+			*size.value = -1
+			continue
+		}
+		bytes, err := utils.RAMInBytes(val)
+		if err != nil {
+			return fmt.Errorf("invalid %s %s: %v", size.flag, val, err)
+		}
+		*size.value = bytes
+	}
+	if swappiness := ctx.Int64("memory-swappiness"); swappiness != -1 {
+		if swappiness < 0 || swappiness > 100 {
+			return fmt.Errorf("invalid memory swappiness %d, must be in range [0, 100]", swappiness)
+		}
+		value := uint64(swappiness)
+		res.MemorySwappiness = &value
+	}
+	return nil
+}
+
+// parseCpus 将 --cpus 和 -cpu 换算为 CFS 的 quota 和 period
+// e.g. --cpus 1.5 在默认 100ms 的周期下对应 quota 为 150000，-cpu 50 表示可以使用半个 CPU
+func parseCpus(ctx *cli.Context, res *resource.ResourceConfig) error {
+	cpus := ctx.Float64("cpus")
+	if ctx.IsSet("cpu") {
+		if ctx.IsSet("cpus") {
+			return fmt.Errorf("cpu and cpus parameter can not both provided")
+		}
+		cpus = float64(ctx.Int("cpu")) / 100
+	}
+	if cpus == 0 {
+		return nil
+	}
+	if ctx.IsSet("cpu-quota") || ctx.IsSet("cpu-period") {
+		return fmt.Errorf("cpus can not be used together with cpu-quota or cpu-period")
+	}
+	if cpus < 0 || cpus > float64(runtime.NumCPU()) {
+		return fmt.Errorf("invalid cpus %.2f, must be in range (0, %d]", cpus, runtime.NumCPU())
+	}
+	res.CpuPeriod = resource.DefaultCpuPeriod
+	res.CpuQuota = int64(cpus * resource.DefaultCpuPeriod)
+	return nil
+}
+
 var initCommand = cli.Command{
 	Name:  "init",
 	Usage: `Init container process run user's process in container. Do not call it outside`,
@@ -79,6 +447,7 @@ var execCommand = cli.Command{
 	Usage: "exec a command into container",
 	Flags: []cli.Flag{
 		cli.StringFlag{Name: "name,n", Usage: "exec container Name"},
+		cli.StringFlag{Name: "user,u", Usage: "username or uid and optional groupname or gid,e.g.: --user app:staff"},
 	},
 	Action: func(ctx *cli.Context) error {
 		if os.Getenv(container.EnvExecPid) != "" {
@@ -94,7 +463,7 @@ var execCommand = cli.Command{
 		//containerName := ctx.Args().Get(0)
 		containerName := ctx.String("name")
 		commandArray := ctx.Args()
-		ExecContainer(containerName, commandArray)
+		ExecContainer(containerName, commandArray, ctx.String("user"))
 		return nil
 	},
 }
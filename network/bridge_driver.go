@@ -71,29 +71,22 @@ func (d *BridgeNetworkDriver) DisConnect(network *Network, endpoint *Endpoint) e
 	vethName := endpoint.ID[:5]
 	veth, err := netlink.LinkByName(vethName)
 	if err != nil {
-		return err
+		// 容器的 network namespace 销毁时，内核会删除其中的 cif-xxx 以及与它成对的 veth
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil
+		}
+		return errors.WithMessagef(err, "find veth [%s] failed", vethName)
 	}
 	// 从网桥解绑
 	err = netlink.LinkSetNoMaster(veth)
 	if err != nil {
-		return errors.WithMessagef(err, "find veth [%s] failed,", vethName)
+		return errors.WithMessagef(err, "unbind veth [%s] failed", vethName)
 	}
-	// 删除 veth-pair
-	// 一端为 xxx,另一端为 cif-xxx
+	// 删除 veth-pair 的一端时另一端 cif-xxx 也会被删除，cif-xxx 已经移动到容器的 network namespace 中，在宿主机上也找不到
 	err = netlink.LinkDel(veth)
 	if err != nil {
-		return errors.WithMessagef(err, "delete veth [%s] failed,", vethName)
-	}
-	veth2Name := "cif-" + vethName
-	veth2, err := netlink.LinkByName(veth2Name)
-	if err != nil {
-		return errors.WithMessagef(err, "find veth [%s] failed,", veth2Name)
+		return errors.WithMessagef(err, "delete veth [%s] failed", vethName)
 	}
-	err = netlink.LinkDel(veth2)
-	if err != nil {
-		return errors.WithMessagef(err, "delete veth [%s] failed", veth2Name)
-	}
-
 	return nil
 }
 
@@ -28,7 +28,7 @@ func TestBridgeConnect(t *testing.T) {
 	ep := Endpoint{ID: "testcontainer"}
 	n := Network{Name: testName}
 	d := BridgeNetworkDriver{}
-	err := d.Connect(&n, &ep)
+	err := d.Connect(n.Name, &ep)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -11,27 +11,34 @@ import (
 	"strings"
 )
 
-const ipamDefaultAllocatorPath = "/var/lib/runQ/network/ipam/subnet.json"
+// ipamDefaultAllocatorPath 相对于 constant.StateRoot 的路径
+const ipamDefaultAllocatorPath = "network/ipam/subnet.json"
 
 type IPAM struct {
 	SubnetAllocatorPath string
 	Subnets             *map[string]string
 }
 
-// 初始化一个IPAM的对象，默认使用/var/lib/mydocker/network/ipam/subnet.json作为分配信息存储位置
-var ipAllocator = &IPAM{
-	SubnetAllocatorPath: ipamDefaultAllocatorPath,
+// 初始化一个IPAM的对象，SubnetAllocatorPath 为空时使用 {StateRoot}/network/ipam/subnet.json 作为分配信息存储位置
+var ipAllocator = &IPAM{}
+
+// allocatorPath 状态目录在命令行解析之后才能确定，需要在使用时再拼接默认路径
+func (ipam *IPAM) allocatorPath() string {
+	if ipam.SubnetAllocatorPath != "" {
+		return ipam.SubnetAllocatorPath
+	}
+	return path.Join(constant.StateRoot, ipamDefaultAllocatorPath)
 }
 
 func (ipam *IPAM) load() error {
 	// 检查存储文件状态，如果不存在，则说明之前没有分配，则不需要加载
-	if _, err := os.Stat(ipam.SubnetAllocatorPath); err != nil {
+	if _, err := os.Stat(ipam.allocatorPath()); err != nil {
 		if !os.IsNotExist(err) {
 			return err
 		}
 		return nil
 	}
-	subnetConfigFile, err := os.Open(ipam.SubnetAllocatorPath)
+	subnetConfigFile, err := os.Open(ipam.allocatorPath())
 	if err != nil {
 		return err
 	}
@@ -49,7 +56,7 @@ func (ipam *IPAM) load() error {
 
 // dump 存储网段地址分配信息
 func (ipam *IPAM) dump() error {
-	ipamConfigFileDir, _ := path.Split(ipam.SubnetAllocatorPath)
+	ipamConfigFileDir, _ := path.Split(ipam.allocatorPath())
 	if _, err := os.Stat(ipamConfigFileDir); err != nil {
 		if !os.IsNotExist(err) {
 			return err
@@ -59,7 +66,7 @@ func (ipam *IPAM) dump() error {
 		}
 	}
 	// 打开存储文件 O_TRUNC 表示如果存在则消空， os O_CREATE 表示如果不存在则创建
-	subnetConfigFile, err := os.OpenFile(ipam.SubnetAllocatorPath, os.O_TRUNC|os.O_WRONLY|os.O_CREATE, constant.Perm0644)
+	subnetConfigFile, err := os.OpenFile(ipam.allocatorPath(), os.O_TRUNC|os.O_WRONLY|os.O_CREATE, constant.Perm0644)
 	if err != nil {
 		return err
 	}
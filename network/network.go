@@ -20,26 +20,16 @@ import (
 	"text/tabwriter"
 )
 
-var (
-	defaultNetworkPath = "/var/lib/runQ/network/network/"
-	drivers            = map[string]Driver{}
-)
+var drivers = map[string]Driver{}
 
 func init() {
 	var bridgeDriver = BridgeNetworkDriver{}
 	drivers[bridgeDriver.Name()] = &bridgeDriver
+}
 
-	// 文件不存在则创建
-	if _, err := os.Stat(defaultNetworkPath); err != nil {
-		if !os.IsNotExist(err) {
-			log.Errorf("check %s is exist failed,detail: %v", defaultNetworkPath, err)
-			return
-		}
-		if err = os.MkdirAll(defaultNetworkPath, constant.Perm0644); err != nil {
-			log.Errorf("create %s failed,detail: %v", defaultNetworkPath, err)
-			return
-		}
-	}
+// networkPath 网络配置的保存目录，跟随 constant.StateRoot，不能在包初始化时确定
+func networkPath() string {
+	return path.Join(constant.StateRoot, "network", "network") + "/"
 }
 
 func (net *Network) dump(dumpPath string) error {
@@ -96,8 +86,12 @@ func (net *Network) load(dumpPath string) error {
 
 func loadNetwork() (map[string]*Network, error) {
 	networks := map[string]*Network{}
+	// 目录不存在则创建
+	if err := os.MkdirAll(networkPath(), constant.Perm0644); err != nil {
+		return networks, errors.Wrapf(err, "create %s failed", networkPath())
+	}
 	// 检查网络配置目录中的所有文件,并执行第二个参数中的函数指针去处理目录下的每一个文件
-	err := filepath.Walk(defaultNetworkPath, func(netPath string, info fs.FileInfo, err error) error {
+	err := filepath.Walk(networkPath(), func(netPath string, info fs.FileInfo, err error) error {
 		if info.IsDir() {
 			return nil
 		}
@@ -130,7 +124,7 @@ func CreateNetwork(driver, subnet, name string) error {
 		return err
 	}
 	// 保存网络信息，将网络的信息保存在文件系统中，以便查询和在网络上连接网络端点
-	return net.dump(defaultNetworkPath)
+	return net.dump(networkPath())
 }
 
 func ListNetwork() {
@@ -176,7 +170,7 @@ func DeleteNetwork(networkName string) error {
 		return errors.Wrap(err, "remove Network DriverError failed")
 	}
 
-	return net.remove(defaultNetworkPath)
+	return net.remove(networkPath())
 }
 
 // Connect 连接容器到之前创建的网络 mydocker run -net testnet -p 8080:80 xxxx
@@ -209,6 +203,34 @@ func Connect(networkName string, info *container.ContainerInfo) (net.IP, error)
 	return ip, configPortMapping(ep)
 }
 
+// Disconnect 断开容器与网络的连接，删除端口映射并释放容器的 IP，ip 为 Connect 分配的地址
+func Disconnect(networkName string, info *container.ContainerInfo, ip string) error {
+	networks, err := loadNetwork()
+	if err != nil {
+		return errors.WithMessage(err, "load network from file failed")
+	}
+	network, ok := networks[networkName]
+	if !ok {
+		return fmt.Errorf("no Such Network: %s", networkName)
+	}
+	ipAddress := net.ParseIP(ip)
+	if ipAddress == nil {
+		return fmt.Errorf("invalid ip %s", ip)
+	}
+	ep := &Endpoint{
+		ID:          fmt.Sprintf("%s-%s", info.Id, networkName),
+		IPAddress:   ipAddress,
+		Network:     network,
+		PortMapping: info.PortMapping,
+	}
+	deletePortMapping(ep)
+	if err = drivers[network.Driver].DisConnect(network, ep); err != nil {
+		log.Warnf("Disconnect endpoint %s error %v", ep.ID, err)
+	}
+	// Release 会修改传入的 IP，不能使用 Endpoint 中的地址
+	return ipAllocator.Release(network.IPRange, &ipAddress)
+}
+
 func configEndpointIpAddressAndRoute(ep *Endpoint, info *container.ContainerInfo) error {
 	peerLink, err := netlink.LinkByName(ep.Device.PeerName)
 	if err != nil {
@@ -259,9 +281,7 @@ func configPortMapping(ep *Endpoint) error {
 			log.Errorf("port mapping format error, %v", err)
 			continue
 		}
-		iptablesCmd := fmt.Sprintf("-t nat -A PREROUTING ! -i %s -p tcp -m tcp --dport %s -j DNAT --to-destination %s:%s",
-			ep.Network.Name, portMapping[0], ep.IPAddress.String(), portMapping[1])
-		cmd := exec.Command("iptables", strings.Split(iptablesCmd, " ")...)
+		cmd := portMappingCmd("-A", ep, portMapping)
 		log.Infoln("配置端口映射 cmd：", cmd.String())
 		output, err := cmd.Output()
 		if err != nil {
@@ -272,6 +292,27 @@ func configPortMapping(ep *Endpoint) error {
 	return err
 }
 
+// deletePortMapping 删除 configPortMapping 添加的 DNAT 规则，规则不存在时忽略
+func deletePortMapping(ep *Endpoint) {
+	for _, pm := range ep.PortMapping {
+		portMapping := strings.Split(pm, ":")
+		if len(portMapping) != 2 {
+			continue
+		}
+		cmd := portMappingCmd("-D", ep, portMapping)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			log.Warnf("Delete port mapping %s error %v, %s", pm, err, output)
+		}
+	}
+}
+
+// portMappingCmd 端口映射的 iptables 命令，action 为 -A 添加或者 -D 删除
+func portMappingCmd(action string, ep *Endpoint, portMapping []string) *exec.Cmd {
+	iptablesCmd := fmt.Sprintf("-t nat %s PREROUTING ! -i %s -p tcp -m tcp --dport %s -j DNAT --to-destination %s:%s",
+		action, ep.Network.Name, portMapping[0], ep.IPAddress.String(), portMapping[1])
+	return exec.Command("iptables", strings.Split(iptablesCmd, " ")...)
+}
+
 func enterContainerNetNS(enLink *netlink.Link, info *container.ContainerInfo) func() {
 	// 找到容器的Net Namespace
 	// /proc/[pid]/ns/net 打开这个文件的文件描述符就可以来操作Net Namespace
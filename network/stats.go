@@ -0,0 +1,68 @@
+package network
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// InterfaceStats 容器内网络接口的收发统计
+type InterfaceStats struct {
+	Name      string `json:"name"`
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// GetInterfaceStats 读取容器 net namespace 中各个网络接口的统计
+// /proc/{pid}/net/dev 展示的是该进程所在 net namespace 的数据，因此不需要进入容器的 namespace
+// 文件格式为两行表头，之后每行为 "  eth0: rx_bytes rx_packets rx_errs rx_drop ... tx_bytes tx_packets tx_errs tx_drop ..."
+func GetInterfaceStats(pid string) ([]*InterfaceStats, error) {
+	netDevPath := fmt.Sprintf("/proc/%s/net/dev", pid)
+	content, err := os.ReadFile(netDevPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", netDevPath)
+	}
+	lines := strings.Split(string(content), "\n")
+	var result []*InterfaceStats
+	for _, line := range lines[min(2, len(lines)):] {
+		name, counters, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		// 回环接口的流量不计入容器的网络 IO
+		if name == "lo" {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 16 {
+			continue
+		}
+		values := make([]uint64, 16)
+		for i := range values {
+			if values[i], err = strconv.ParseUint(fields[i], 10, 64); err != nil {
+				return nil, errors.Wrapf(err, "parse %s", netDevPath)
+			}
+		}
+		result = append(result, &InterfaceStats{
+			Name:      name,
+			RxBytes:   values[0],
+			RxPackets: values[1],
+			RxErrors:  values[2],
+			RxDropped: values[3],
+			TxBytes:   values[8],
+			TxPackets: values[9],
+			TxErrors:  values[10],
+			TxDropped: values[11],
+		})
+	}
+	return result, nil
+}
@@ -9,9 +9,137 @@ package nsenter
 #include <stdlib.h>
 #include <string.h>
 #include <fcntl.h>
+#include <grp.h>
+#include <sys/prctl.h>
+#include <sys/stat.h>
+#include <sys/syscall.h>
+#include <linux/capability.h>
+#include <linux/filter.h>
+#include <linux/seccomp.h>
+
+#ifndef CLONE_NEWTIME
+#define CLONE_NEWTIME 0x00000080
+#endif
+
+// 容器 init 进程创建 time namespace 并写入时钟偏移
+// timens_offsets 只能在进程级别写入，Go 运行时启动后是多线程的，只能在这里处理
+// unshare 之后当前进程还在原来的 time namespace 中，execve 用户命令时才会进入新的 time namespace
+static void setup_timens(const char *offsets) {
+	if (unshare(CLONE_NEWTIME) == -1) {
+		fprintf(stderr, "unshare time namespace failed: %s\n", strerror(errno));
+		exit(1);
+	}
+	int fd = open("/proc/self/timens_offsets", O_WRONLY);
+	if (fd == -1 || write(fd, offsets, strlen(offsets)) == -1) {
+		fprintf(stderr, "write timens offsets failed: %s\n", strerror(errno));
+		exit(1);
+	}
+	close(fd);
+}
+
+// exec 的进程在进入 namespace 之前加入容器的 cgroup，此时还在宿主机的 mount namespace 中，可以访问 cgroup 文件
+// 之后 system() 创建的用户命令继承这些 cgroup，宿主机上的 runQ exec 进程不在容器的 cgroup 中
+static void join_cgroups(const char *procs) {
+	char pid[16];
+	snprintf(pid, sizeof(pid), "%d", getpid());
+	char *buf = strdup(procs);
+	char *file = strtok(buf, ":");
+	while (file) {
+		int fd = open(file, O_WRONLY);
+		if (fd == -1 || write(fd, pid, strlen(pid)) == -1) {
+			fprintf(stderr, "join cgroup %s failed: %s\n", file, strerror(errno));
+			exit(1);
+		}
+		close(fd);
+		file = strtok(NULL, ":");
+	}
+	free(buf);
+}
+
+// 解析以逗号分隔的 capability 编号
+static void parse_caps(const char *caps, __u32 mask[2]) {
+	mask[0] = mask[1] = 0;
+	char *buf = strdup(caps);
+	char *cap = strtok(buf, ",");
+	while (cap) {
+		int c = atoi(cap);
+		if (c >= 0 && c < 64) {
+			mask[c / 32] |= 1u << (c % 32);
+		}
+		cap = strtok(NULL, ",");
+	}
+	free(buf);
+}
+
+// 与容器的 init 进程一样先收缩 bounding set，之后 system() 执行的命令(包括 setuid 程序)无法再获得其他 capability
+static void drop_bounding_set(__u32 mask[2]) {
+	int c;
+	for (c = 0; c < 64; c++) {
+		if (mask[c / 32] & (1u << (c % 32))) {
+			continue;
+		}
+		if (prctl(PR_CAPBSET_DROP, c, 0, 0, 0) == -1) {
+			// 超过了内核支持的最大 capability
+			if (errno == EINVAL) {
+				break;
+			}
+			fprintf(stderr, "drop capability %d from bounding set failed: %s\n", c, strerror(errno));
+			exit(1);
+		}
+	}
+}
+
+static void set_caps(__u32 mask[2]) {
+	struct __user_cap_header_struct header = { _LINUX_CAPABILITY_VERSION_3, 0 };
+	struct __user_cap_data_struct data[2];
+	int i;
+	for (i = 0; i < 2; i++) {
+		data[i].effective = data[i].permitted = data[i].inheritable = mask[i];
+	}
+	if (syscall(SYS_capset, &header, data) == -1) {
+		fprintf(stderr, "capset failed: %s\n", strerror(errno));
+		exit(1);
+	}
+}
+
+// 安装父进程编译好的 seccomp 过滤程序，这里是单线程的，不需要 TSYNC
+static void install_seccomp(const char *program) {
+	size_t len = strlen(program) / 2, i;
+	unsigned char *buf = malloc(len);
+	for (i = 0; i < len; i++) {
+		sscanf(program + 2 * i, "%2hhx", &buf[i]);
+	}
+	struct sock_fprog prog = { .len = len / sizeof(struct sock_filter), .filter = (struct sock_filter *)buf };
+	if (prctl(PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0) == -1 || prctl(PR_SET_SECCOMP, SECCOMP_MODE_FILTER, &prog) == -1) {
+		fprintf(stderr, "install seccomp filter failed: %s\n", strerror(errno));
+		exit(1);
+	}
+	free(buf);
+}
+
+// 容器与当前进程在同一个 namespace 中时(e.g. --pid host)不需要进入，进入自己所在的 user namespace 还会失败
+static int same_namespace(const char *pid, const char *ns) {
+	char nspath[1024];
+	struct stat target, self;
+	sprintf(nspath, "/proc/%s/ns/%s", pid, ns);
+	// 内核不支持的 namespace 也跳过
+	if (stat(nspath, &target) == -1) {
+		return 1;
+	}
+	sprintf(nspath, "/proc/self/ns/%s", ns);
+	if (stat(nspath, &self) == -1) {
+		return 1;
+	}
+	return target.st_dev == self.st_dev && target.st_ino == self.st_ino;
+}
 
 __attribute__((constructor)) void enter_namespace(void) {
    // 这里的代码会在Go运行时启动前执行，它会在单线程的C上下文中运行
+	char *runQ_timens_offsets = getenv("runQ_timens_offsets");
+	if (runQ_timens_offsets) {
+		setup_timens(runQ_timens_offsets);
+		unsetenv("runQ_timens_offsets");
+	}
 	char *runQ_pid;
 	runQ_pid = getenv("runQ_pid");
 	if (runQ_pid) {
@@ -30,28 +158,104 @@ __attribute__((constructor)) void enter_namespace(void) {
 		// 如果没有指定命令也是直接退出
 		return;
 	}
+	char *runQ_cgroup_procs = getenv("runQ_cgroup_procs");
+	if (runQ_cgroup_procs) {
+		join_cgroups(runQ_cgroup_procs);
+		unsetenv("runQ_cgroup_procs");
+	}
 	int i;
 	char nspath[1024];
-	// 需要进入的5种namespace
-	char *namespaces[] = { "ipc", "uts", "net", "pid", "mnt" };
+	// 容器使用了 user namespace 时需要先进入 user namespace，获得其中的 capability 之后才能进入其他 namespace
+	// mnt namespace 最后进入，进入之后 /proc 是容器的，无法再通过宿主机上的 pid 打开其他 namespace
+	char *namespaces[] = { "user", "ipc", "uts", "net", "pid", "cgroup", "time", "mnt" };
 
-	for (i=0; i<5; i++) {
+	for (i=0; i<8; i++) {
+		// 只进入容器实际使用的 namespace，与宿主机或者 runQ 共享的 namespace 跳过
+		if (same_namespace(runQ_pid, namespaces[i])) {
+			continue;
+		}
 		// 拼接对应路径，类似于/proc/pid/ns/ipc这样
 		sprintf(nspath, "/proc/%s/ns/%s", runQ_pid, namespaces[i]);
 		int fd = open(nspath, O_RDONLY);
 		// 执行setns系统调用，进入对应namespace
 		if (setns(fd, 0) == -1) {
 			fprintf(stderr, "setns on %s namespace failed: %s\n", namespaces[i], strerror(errno));
+			// 没有进入 user namespace 时在其他 namespace 中没有权限
+			if (i == 0) {
+				exit(1);
+			}
 		} else {
 			fprintf(stdout, "setns on %s namespace succeeded\n", namespaces[i]);
 		}
 		close(fd);
 	}
+	// bounding set 需要在切换用户之前收缩，切换用户之后就没有 CAP_SETPCAP 了
+	// keepcaps 使切换到非 root 用户之后还能设置 permitted 集合
+	__u32 caps[2];
+	char *runQ_caps = getenv("runQ_caps");
+	if (runQ_caps) {
+		parse_caps(runQ_caps, caps);
+		drop_bounding_set(caps);
+		if (prctl(PR_SET_KEEPCAPS, 1, 0, 0, 0) == -1) {
+			fprintf(stderr, "set keepcaps failed: %s\n", strerror(errno));
+			exit(1);
+		}
+	}
+	// 指定了用户时需要切换用户，顺序必须是 setgroups、setgid、setuid，用户已经由父进程根据容器中的 /etc/passwd 解析好
+	char *runQ_uid = getenv("runQ_uid");
+	if (runQ_uid) {
+		gid_t groups[64];
+		int ngroups = 0;
+		char *runQ_groups = getenv("runQ_groups");
+		if (runQ_groups && strlen(runQ_groups) > 0) {
+			char *buf = strdup(runQ_groups);
+			char *group = strtok(buf, ",");
+			while (group && ngroups < 64) {
+				groups[ngroups++] = (gid_t)atoi(group);
+				group = strtok(NULL, ",");
+			}
+			free(buf);
+		}
+		// rootless 模式下 user namespace 禁用了 setgroups，没有附加组时可以忽略
+		if (setgroups(ngroups, groups) == -1 && !(errno == EPERM && ngroups == 0)) {
+			fprintf(stderr, "setgroups failed: %s\n", strerror(errno));
+			exit(1);
+		}
+		char *runQ_gid = getenv("runQ_gid");
+		if (runQ_gid && setgid((gid_t)atoi(runQ_gid)) == -1) {
+			fprintf(stderr, "setgid failed: %s\n", strerror(errno));
+			exit(1);
+		}
+		if (setuid((uid_t)atoi(runQ_uid)) == -1) {
+			fprintf(stderr, "setuid failed: %s\n", strerror(errno));
+			exit(1);
+		}
+		char *runQ_home = getenv("runQ_home");
+		if (runQ_home) {
+			setenv("HOME", runQ_home, 1);
+		}
+		// 用户已经切换完成，不再把这些变量留给用户命令
+		unsetenv("runQ_uid");
+		unsetenv("runQ_gid");
+		unsetenv("runQ_groups");
+		unsetenv("runQ_home");
+	}
+	if (runQ_caps) {
+		set_caps(caps);
+		unsetenv("runQ_caps");
+	}
+	// seccomp 最后安装，之前切换用户、设置 capability 的系统调用不受过滤规则的限制
+	char *runQ_seccomp = getenv("runQ_seccomp");
+	if (runQ_seccomp) {
+		char *program = strdup(runQ_seccomp);
+		unsetenv("runQ_seccomp");
+		install_seccomp(program);
+		free(program);
+	}
 	// 在进入的Namespace中执行指定命令，然后退出
 	int res = system(runQ_cmd);
 	exit(0);
 	return;
 }
 */
-
 import "C"
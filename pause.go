@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"github.com/urfave/cli"
+	"runQ/container"
+)
+
+var pauseCommand = cli.Command{
+	Name:  "pause",
+	Usage: "pause all processes within a container, e.g. runQ pause 1234567890",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("missing container name")
+		}
+		return container.PauseContainer(ctx.Args().Get(0))
+	},
+}
+
+var unpauseCommand = cli.Command{
+	Name:  "unpause",
+	Usage: "unpause all processes within a container, e.g. runQ unpause 1234567890",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("missing container name")
+		}
+		return container.UnpauseContainer(ctx.Args().Get(0))
+	},
+}
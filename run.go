@@ -1,58 +1,198 @@
 package main
 
 import (
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"os"
 	"runQ/cgroups"
 	"runQ/cgroups/resource"
+	"runQ/constant"
 	"runQ/container"
 	"runQ/network"
+	"runQ/seccomp"
 	"strconv"
 	"strings"
 )
 
-func Run(tty bool, comArray, envSlice []string, res *resource.ResourceConfig, volume, containerName, imageName string,
-	net string, portMapping []string) {
+// RunOptions run 命令的参数
+type RunOptions struct {
+	Tty          bool
+	Cmd          []string
+	Env          []string
+	Resource     *resource.ResourceConfig
+	Volume       string
+	Name         string
+	Image        string
+	Network      string
+	PortMapping  []string
+	CgroupParent string
+	ShmSize      int64    // /dev/shm 的大小，单位为字节
+	Privileged   bool     // 保留所有 capability，允许访问所有设备
+	Capabilities []string // 容器进程保留的 capability
+	// SeccompProfile default、unconfined 或者 profile 的路径，Seccomp 为编译好的过滤程序
+	SeccompProfile string
+	Seccomp        seccomp.Program
+	User           string             // 运行容器进程的用户，user[:group]
+	Readonly       bool               // 根文件系统只读
+	Tmpfs          []*container.Mount // --tmpfs 挂载的 tmpfs
+	// UidMappings、GidMappings 不为空时容器运行在独立的 user namespace 中
+	UidMappings []container.IDMap
+	GidMappings []container.IDMap
+	Namespaces  *container.Namespaces // pid、ipc、uts、cgroup、time namespace 的配置
+	Hostname    string                // 容器的主机名，为空时使用容器 ID
+	Domainname  string
+	ExtraHosts  []string // --add-host 添加到 /etc/hosts 中的记录，host:ip
+	DNS         []string // 以下三项为空时使用宿主机 /etc/resolv.conf 中的配置
+	DNSSearch   []string
+	DNSOptions  []string
+	Ulimits     []*container.Rlimit // execve 之前设置的资源限制
+	Sysctls     map[string]string   // 写入容器 /proc/sys 的 sysctl
+	OOMScoreAdj *int                // 为 nil 时继承 runQ 的 oom_score_adj
+}
+
+func Run(opts *RunOptions) error {
+	tty, comArray, res, volume := opts.Tty, opts.Cmd, opts.Resource, opts.Volume
+	containerName, net, portMapping := opts.Name, opts.Network, opts.PortMapping
 
 	containerId := container.GenerateContainerID()
-	parent, writePipe := container.NewParentProcess(tty, volume, containerId, imageName, envSlice)
+	parent, writePipe, syncPipe := container.NewParentProcess(tty, volume, containerId, opts.Image, opts.UidMappings, opts.GidMappings,
+		opts.Namespaces)
 	if parent == nil {
-		log.Errorf("New parent process error")
-		return
+		return errors.New("new parent process error")
 	}
 
-	if err := parent.Start(); err != nil {
-		log.Errorf("Run parent. Start err: %v", err)
-		return
+	if err := container.StartParentProcess(parent, opts.Namespaces); err != nil {
+		container.DeleteWorkSpace(containerId, volume)
+		return errors.Wrap(err, "start parent process")
 	}
 
-	_, err := container.RecordContainerInfo(parent.Process.Pid, comArray, containerName, containerId, volume, net, portMapping)
+	// 每个容器使用独立的 cgroup，路径记录到容器信息中，供 stop/rm/exec 使用
+	cgroupPath := cgroups.ContainerCgroupPath(opts.CgroupParent, containerId)
+	if constant.Rootless {
+		cgroupPath = rootlessCgroupPath(opts.CgroupParent, containerId)
+	}
+	containerInfo, err := container.RecordContainerInfo(parent.Process.Pid, comArray, containerName, containerId, volume, net, portMapping,
+		cgroupPath, res, opts.Privileged, opts.Capabilities, opts.SeccompProfile, opts.Seccomp,
+		opts.UidMappings, opts.GidMappings, opts.Namespaces)
 
 	if err != nil {
-		log.Errorf("Record container info error %v", err)
-		return
+		_ = parent.Process.Kill()
+		_ = parent.Wait()
+		container.DeleteWorkSpace(containerId, volume)
+		return errors.WithMessage(err, "record container info")
 	}
 
-	cgroupManager := cgroups.NewCgroupManager("runQ-cgroup")
-	defer cgroupManager.Destroy()
-	_ = cgroupManager.Set(res)
-	_ = cgroupManager.Apply(parent.Process.Pid, res)
+	cgroupManager := cgroups.NewCgroupManager(cgroupPath)
+	containerIP := ""
+	// 容器启动失败时不能记录为 running，需要清理已经创建的资源
+	cleanup := func() {
+		_ = parent.Process.Kill()
+		_ = parent.Wait()
+		// 释放 Connect 分配的 IP 和端口映射，veth 随容器的 network namespace 一起删除
+		if containerIP != "" {
+			if err := network.Disconnect(net, containerInfo, containerIP); err != nil {
+				log.Errorf("Disconnect container %s from network %s error %v", containerId, net, err)
+			}
+		}
+		container.DeleteWorkSpace(containerId, volume)
+		_ = container.DeleteContainerInfo(containerId)
+		if cgroupPath != "" {
+			_ = cgroupManager.Destroy()
+		}
+	}
+	// 资源限制设置失败时不能在没有限制或者只有部分限制的情况下启动容器
+	if cgroupPath != "" {
+		if err = cgroupManager.Set(res); err != nil {
+			cleanup()
+			return errors.WithMessagef(err, "set cgroup %s", cgroupPath)
+		}
+		if err = cgroupManager.Apply(parent.Process.Pid, res); err != nil {
+			cleanup()
+			return errors.WithMessagef(err, "apply cgroup %s", cgroupPath)
+		}
+	}
 	log.Infof("Current container pid is %d", parent.Process.Pid)
+	if opts.OOMScoreAdj != nil {
+		if err = container.SetOOMScoreAdj(parent.Process.Pid, *opts.OOMScoreAdj); err != nil {
+			log.Errorf("Set oom_score_adj of container %s error %v", containerId, err)
+		}
+	}
 
 	if net != "" {
-		containerInfo := &container.ContainerInfo{
+		netInfo := &container.ContainerInfo{
 			Id:          containerId,
 			Pid:         strconv.Itoa(parent.Process.Pid),
 			Name:        containerName,
 			PortMapping: portMapping,
 		}
-		if _, err = network.Connect(net, containerInfo); err != nil {
+		ip, err := network.Connect(net, netInfo)
+		if err != nil {
 			log.Errorf("Error Connect Network %v", err)
 		}
+		if ip != nil {
+			containerIP = ip.String()
+		}
+	}
+	devices := container.DefaultDevices
+	// 特权容器可以访问所有设备，/dev 中也需要有宿主机的设备
+	if opts.Privileged {
+		if devices, err = container.HostDevices(); err != nil {
+			cleanup()
+			return err
+		}
+	}
+	etcConfig := etcFilesConfig(opts, containerId, containerIP)
+	etcMounts, err := container.SetupEtcFiles(containerId, etcConfig)
+	if err != nil {
+		log.Errorf("Setup /etc files of container %s error %v", containerId, err)
 	}
 
 	// 在子进程创建后通过管道来发送参数
-	sendInitCommand(comArray, writePipe)
+	initConfig := &container.InitConfig{
+		Args:    comArray,
+		Env:     append(hostEnv(), opts.Env...),
+		User:    opts.User,
+		Cwd:     constant.ROOTDIR,
+		Mounts:  append(containerMounts(opts), etcMounts...),
+		Devices: devices,
+		Rlimits: opts.Ulimits,
+		Sysctls: opts.Sysctls,
+		// 非 nil 的空列表表示删除所有 capability
+		Capabilities: opts.Capabilities,
+		Seccomp:      opts.Seccomp,
+		Readonly:     opts.Readonly,
+		Cgroupns:     opts.Namespaces.PrivateCgroupns(),
+	}
+	// 使用宿主机的 uts namespace 时不能修改主机名
+	if opts.Namespaces.Uts != container.NamespaceHost {
+		initConfig.Hostname = etcConfig.Hostname
+		initConfig.Domainname = etcConfig.Domainname
+	}
+	// rootless 模式下 overlay 和数据卷都由 init 进程在容器的 mount namespace 中挂载
+	if constant.Rootless {
+		initConfig.Rootfs = container.OverlayMount(containerId)
+		if volume != "" {
+			volumeMount, err := container.VolumeMount(volume)
+			if err != nil {
+				log.Errorf("extract volume failed，maybe volume parameter input is not correct，detail:%v", err)
+			} else {
+				initConfig.Mounts = append(initConfig.Mounts, volumeMount)
+			}
+		}
+	}
+	// 特权容器与 docker 一样不屏蔽内核路径
+	if !opts.Privileged {
+		initConfig.MaskedPaths = container.DefaultMaskedPaths
+		initConfig.ReadonlyPaths = container.DefaultReadonlyPaths
+	}
+	if err = container.SendInitConfig(writePipe, initConfig); err != nil {
+		log.Errorf("Send init config error %v", err)
+	}
+	// 等待 init 进程完成初始化并 execve 用户命令
+	if err = container.WaitInitReady(syncPipe); err != nil {
+		cleanup()
+		return err
+	}
 
 	//go func() {
 	//	if !tty {
@@ -64,17 +204,80 @@ func Run(tty bool, comArray, envSlice []string, res *resource.ResourceConfig, vo
 	//	_ = container.DeleteContainerInfo(containerId)
 	//	_ = cgroupManager.Destroy()
 	//}()
-	if tty {
-		_ = parent.Wait()
-		container.DeleteWorkSpace(containerId, volume)
-		_ = container.DeleteContainerInfo(containerId)
+	container.RecordEvent(container.EventStart, containerInfo, nil)
+	// 后台运行的容器在 runQ 退出后仍在运行，其 cgroup 由 stop/rm 负责清理，退出状态由 monitor 进程记录
+	if !tty {
+		if err = container.StartMonitor(containerId); err != nil {
+			log.Errorf("Start monitor of container %s error %v", containerId, err)
+		}
+		return nil
+	}
+	watcher := container.WatchOOM(containerInfo)
+	_ = parent.Wait()
+	// 需要在删除 cgroup 之前判断是否发生过 OOM
+	oomKilled, reason := watcher.ExitReason()
+	if oomKilled {
+		log.Warnf("Container %s was killed by OOM killer", containerId)
+	}
+	container.RecordEvent(container.EventDie, containerInfo, map[string]string{"exitReason": reason})
+	container.DeleteWorkSpace(containerId, volume)
+	_ = container.DeleteContainerInfo(containerId)
+	if cgroupPath != "" {
+		_ = cgroupManager.Destroy()
+	}
+	return nil
+}
+
+// containerMounts 容器默认的挂载点和 --tmpfs，使用宿主机的 ipc namespace 时 /dev/shm 也使用宿主机的
+func containerMounts(opts *RunOptions) []*container.Mount {
+	mounts := container.DefaultMounts(opts.ShmSize)
+	if shm := opts.Namespaces.ShmMount(); shm != nil {
+		for i, m := range mounts {
+			if m.Destination == shm.Destination {
+				mounts[i] = shm
+			}
+		}
+	}
+	return append(mounts, opts.Tmpfs...)
+}
+
+// etcFilesConfig 生成 /etc/hostname、/etc/hosts 的主机名默认为容器 ID，使用宿主机的 uts namespace 时为宿主机的主机名
+func etcFilesConfig(opts *RunOptions, containerId, containerIP string) *container.EtcFilesConfig {
+	hostname := opts.Hostname
+	if opts.Namespaces.Uts == container.NamespaceHost {
+		hostname, _ = os.Hostname()
+	} else if hostname == "" {
+		hostname = containerId
 	}
+	return &container.EtcFilesConfig{
+		Hostname:   hostname,
+		Domainname: opts.Domainname,
+		IP:         containerIP,
+		ExtraHosts: opts.ExtraHosts,
+		DNS:        opts.DNS,
+		DNSSearch:  opts.DNSSearch,
+		DNSOptions: opts.DNSOptions,
+	}
+}
 
+// rootlessCgroupPath rootless 模式下容器的 cgroup 路径，没有委派的 cgroup v2 子树时返回空，不限制资源
+func rootlessCgroupPath(cgroupParent, containerId string) string {
+	parent, err := cgroups.RootlessParent(cgroupParent)
+	if err != nil {
+		log.Warnf("Resource limits are ignored in rootless mode: %v", err)
+		return ""
+	}
+	return cgroups.ContainerCgroupPath(parent, containerId)
 }
 
-func sendInitCommand(comArray []string, writePipe *os.File) {
-	command := strings.Join(comArray, " ")
-	log.Infof("command all is %s", command)
-	_, _ = writePipe.WriteString(command)
-	_ = writePipe.Close()
+// hostEnv 容器继承的宿主机环境变量，HOME 由容器 init 进程根据用户设置，不能继承宿主机的
+// RUNQ_ROOTLESS 只用于 runQ 自己的子进程
+func hostEnv() []string {
+	var env []string
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, "HOME=") && !strings.HasPrefix(e, constant.EnvRootless+"=") {
+			env = append(env, e)
+		}
+	}
+	return env
 }
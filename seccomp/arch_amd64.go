@@ -0,0 +1,10 @@
+package seccomp
+
+import "golang.org/x/sys/unix"
+
+const (
+	nativeArch     = unix.AUDIT_ARCH_X86_64
+	nativeArchName = "SCMP_ARCH_X86_64"
+	// x32SyscallBit x32 ABI 的系统调用编号带有这个标志位，与 x86_64 的 arch 相同，需要单独拒绝，否则可以绕过过滤规则
+	x32SyscallBit = 0x40000000
+)
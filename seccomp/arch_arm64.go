@@ -0,0 +1,9 @@
+package seccomp
+
+import "golang.org/x/sys/unix"
+
+const (
+	nativeArch     = unix.AUDIT_ARCH_AARCH64
+	nativeArchName = "SCMP_ARCH_AARCH64"
+	x32SyscallBit  = 0
+)
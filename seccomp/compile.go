@@ -0,0 +1,245 @@
+package seccomp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/sys/unix"
+)
+
+// seccomp 过滤程序的返回值
+const (
+	retKillProcess = 0x80000000
+	retKillThread  = 0x00000000
+	retTrap        = 0x00030000
+	retErrno       = 0x00050000
+	retTrace       = 0x7ff00000
+	retLog         = 0x7ffc0000
+	retAllow       = 0x7fff0000
+)
+
+// struct seccomp_data 中各个字段的偏移
+const (
+	offsetNr   = 0
+	offsetArch = 4
+	offsetArgs = 16
+)
+
+// fail 跳转到当前规则代码块的末尾，即下一条规则，在代码块生成完之后统一填写偏移
+const fail = 0xff
+
+// Program 编译后的 classic BPF 程序
+type Program []unix.SockFilter
+
+// Hex 将程序按 struct sock_filter 的内存布局编码为十六进制字符串，exec 时传递给 nsenter 直接安装
+func (p Program) Hex() string {
+	buf := make([]byte, 0, len(p)*8)
+	for _, insn := range p {
+		buf = binary.NativeEndian.AppendUint16(buf, insn.Code)
+		buf = append(buf, insn.Jt, insn.Jf)
+		buf = binary.NativeEndian.AppendUint32(buf, insn.K)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func stmt(code uint16, k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: code, K: k}
+}
+
+func jump(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
+
+func loadAbs(offset uint32) unix.SockFilter {
+	return stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offset)
+}
+
+func ret(value uint32) unix.SockFilter {
+	return stmt(unix.BPF_RET|unix.BPF_K, value)
+}
+
+// Compile 将 profile 编译为 BPF 程序，caps 为容器的 capability，用于判断规则的 includes/excludes 是否满足
+// 规则按顺序匹配，第一条匹配的规则生效，都不匹配时执行 defaultAction
+func Compile(profile *Profile, caps []string) (Program, error) {
+	defaultRet, err := actionRet(profile.DefaultAction, profile.DefaultErrnoRet)
+	if err != nil {
+		return nil, err
+	}
+	eperm := uint32(retErrno | unix.EPERM)
+	filter := Program{
+		// 只支持当前架构的系统调用，其他架构(e.g. x86_64 上的 i386)的系统调用编号不同，直接拒绝
+		loadAbs(offsetArch),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, nativeArch, 1, 0),
+		ret(eperm),
+		loadAbs(offsetNr),
+	}
+	if x32SyscallBit != 0 {
+		filter = append(filter, jump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, x32SyscallBit, 0, 1), ret(eperm))
+	}
+	for _, syscall := range profile.Syscalls {
+		if !syscall.enabled(caps) {
+			continue
+		}
+		value, err := actionRet(syscall.Action, syscall.ErrnoRet)
+		if err != nil {
+			return nil, err
+		}
+		names := syscall.Names
+		if syscall.Name != "" {
+			names = append(names, syscall.Name)
+		}
+		for _, name := range names {
+			nr, ok := syscallTable[name]
+			// 当前架构不存在的系统调用(e.g. arm64 上的 open)直接忽略，与 libseccomp 的行为一致
+			if !ok {
+				continue
+			}
+			block, err := compileRule(uint32(nr), syscall.Args, value)
+			if err != nil {
+				return nil, fmt.Errorf("compile rule of syscall %s: %v", name, err)
+			}
+			filter = append(filter, block...)
+		}
+	}
+	filter = append(filter, ret(defaultRet))
+	if len(filter) > unix.BPF_MAXINSNS {
+		return nil, fmt.Errorf("seccomp filter has too many instructions %d, max %d", len(filter), unix.BPF_MAXINSNS)
+	}
+	return filter, nil
+}
+
+// compileRule 生成单个系统调用的代码块，进入代码块时累加器中为系统调用编号
+func compileRule(nr uint32, args []*Arg, value uint32) ([]unix.SockFilter, error) {
+	block := []unix.SockFilter{jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, nr, 0, fail)}
+	for _, arg := range args {
+		insns, err := compileArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		block = append(block, insns...)
+	}
+	block = append(block, ret(value))
+	// 比较参数时会覆盖累加器，跳到下一条规则之前需要重新加载系统调用编号
+	if len(args) > 0 {
+		block = append(block, loadAbs(offsetNr))
+	}
+	end := len(block)
+	if len(args) > 0 {
+		end = len(block) - 1
+	}
+	for i := range block {
+		if block[i].Code&0x07 != unix.BPF_JMP {
+			continue
+		}
+		if end-i-1 > 0xfe {
+			return nil, fmt.Errorf("rule is too long")
+		}
+		if block[i].Jt == fail {
+			block[i].Jt = uint8(end - i - 1)
+		}
+		if block[i].Jf == fail {
+			block[i].Jf = uint8(end - i - 1)
+		}
+	}
+	return block, nil
+}
+
+// compileArg 比较 64 位的参数，classic BPF 只能加载 32 位，需要分别比较高 32 位和低 32 位
+// 条件满足时继续执行下一条指令，不满足时跳到 fail
+func compileArg(arg *Arg) ([]unix.SockFilter, error) {
+	if arg.Index > 5 {
+		return nil, fmt.Errorf("invalid argument index %d", arg.Index)
+	}
+	// 小端序下低 32 位在前
+	lo, hi := offsetArgs+uint32(arg.Index)*8, offsetArgs+uint32(arg.Index)*8+4
+	valueLo, valueHi := uint32(arg.Value), uint32(arg.Value>>32)
+	jeq := uint16(unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K)
+	jgt := uint16(unix.BPF_JMP | unix.BPF_JGT | unix.BPF_K)
+	jge := uint16(unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K)
+	switch arg.Op {
+	case OpEqualTo:
+		return []unix.SockFilter{loadAbs(hi), jump(jeq, valueHi, 0, fail), loadAbs(lo), jump(jeq, valueLo, 0, fail)}, nil
+	case OpNotEqual:
+		// 高 32 位不相等时跳过低 32 位的比较
+		return []unix.SockFilter{loadAbs(hi), jump(jeq, valueHi, 0, 2), loadAbs(lo), jump(jeq, valueLo, fail, 0)}, nil
+	case OpMaskedEqual:
+		and := uint16(unix.BPF_ALU | unix.BPF_AND | unix.BPF_K)
+		return []unix.SockFilter{
+			loadAbs(hi), stmt(and, valueHi), jump(jeq, uint32(arg.ValueTwo>>32), 0, fail),
+			loadAbs(lo), stmt(and, valueLo), jump(jeq, uint32(arg.ValueTwo), 0, fail),
+		}, nil
+	case OpGreaterThan, OpGreaterEqual:
+		// 高 32 位大于时满足条件，相等时再比较低 32 位
+		last := jump(jgt, valueLo, 0, fail)
+		if arg.Op == OpGreaterEqual {
+			last = jump(jge, valueLo, 0, fail)
+		}
+		return []unix.SockFilter{loadAbs(hi), jump(jgt, valueHi, 3, 0), jump(jeq, valueHi, 0, fail), loadAbs(lo), last}, nil
+	case OpLessThan, OpLessEqual:
+		// 高 32 位小于时满足条件，相等时再比较低 32 位
+		last := jump(jge, valueLo, fail, 0)
+		if arg.Op == OpLessEqual {
+			last = jump(jgt, valueLo, fail, 0)
+		}
+		return []unix.SockFilter{loadAbs(hi), jump(jge, valueHi, 0, 3), jump(jeq, valueHi, 0, fail), loadAbs(lo), last}, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", arg.Op)
+}
+
+func actionRet(action Action, errnoRet *uint) (uint32, error) {
+	switch action {
+	case ActKill, ActKillThread:
+		return retKillThread, nil
+	case ActKillProcess:
+		return retKillProcess, nil
+	case ActTrap:
+		return retTrap, nil
+	case ActErrno:
+		errno := uint32(unix.EPERM)
+		if errnoRet != nil {
+			errno = uint32(*errnoRet)
+		}
+		return retErrno | errno&0xffff, nil
+	case ActTrace:
+		return retTrace, nil
+	case ActLog:
+		return retLog, nil
+	case ActAllow:
+		return retAllow, nil
+	}
+	return 0, fmt.Errorf("unknown seccomp action %s", action)
+}
+
+// enabled 根据 includes/excludes 判断规则是否生效
+func (s *Syscall) enabled(caps []string) bool {
+	if s.Includes != nil {
+		for _, c := range s.Includes.Caps {
+			if !contains(caps, c) {
+				return false
+			}
+		}
+		if len(s.Includes.Arches) > 0 && !contains(s.Includes.Arches, nativeArchName) {
+			return false
+		}
+	}
+	if s.Excludes != nil {
+		for _, c := range s.Excludes.Caps {
+			if contains(caps, c) {
+				return false
+			}
+		}
+		if contains(s.Excludes.Arches, nativeArchName) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
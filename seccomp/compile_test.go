@@ -0,0 +1,214 @@
+package seccomp
+
+import (
+	"encoding/binary"
+	"golang.org/x/sys/unix"
+	"testing"
+)
+
+// run 在 seccomp_data 上模拟执行 BPF 程序，只支持编译器生成的指令，返回过滤结果
+func run(t *testing.T, program Program, arch uint32, nr int, args ...uint64) uint32 {
+	t.Helper()
+	// struct seccomp_data: nr、arch、instruction_pointer、args[6]
+	data := make([]byte, offsetArgs+6*8)
+	binary.LittleEndian.PutUint32(data[offsetNr:], uint32(nr))
+	binary.LittleEndian.PutUint32(data[offsetArch:], arch)
+	for i, arg := range args {
+		binary.LittleEndian.PutUint64(data[offsetArgs+i*8:], arg)
+	}
+	var acc uint32
+	for pc := 0; pc < len(program); pc++ {
+		insn := program[pc]
+		switch insn.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			acc = binary.LittleEndian.Uint32(data[insn.K:])
+		case unix.BPF_ALU | unix.BPF_AND | unix.BPF_K:
+			acc &= insn.K
+		case unix.BPF_RET | unix.BPF_K:
+			return insn.K
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, unix.BPF_JMP | unix.BPF_JGT | unix.BPF_K, unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			var cond bool
+			switch insn.Code &^ (unix.BPF_JMP | unix.BPF_K) {
+			case unix.BPF_JEQ:
+				cond = acc == insn.K
+			case unix.BPF_JGT:
+				cond = acc > insn.K
+			case unix.BPF_JGE:
+				cond = acc >= insn.K
+			}
+			if cond {
+				pc += int(insn.Jt)
+			} else {
+				pc += int(insn.Jf)
+			}
+		default:
+			t.Fatalf("unsupported instruction %d %+v", pc, insn)
+		}
+	}
+	t.Fatal("program ends without return")
+	return 0
+}
+
+func TestCompileDefaultProfile(t *testing.T) {
+	program, err := Compile(DefaultProfile(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := program[len(program)-1]; last.Code != unix.BPF_RET|unix.BPF_K || last.K != retAllow {
+		t.Errorf("last instruction = %+v, expected ret allow", last)
+	}
+	// 拥有 CAP_SYS_ADMIN 时部分规则不生效
+	privileged, err := Compile(DefaultProfile(), []string{"CAP_SYS_ADMIN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(privileged) >= len(program) {
+		t.Errorf("program with CAP_SYS_ADMIN has %d instructions, expected less than %d", len(privileged), len(program))
+	}
+}
+
+func TestCompileInvalidProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile *Profile
+	}{
+		{name: "unknown default action", profile: &Profile{DefaultAction: "SCMP_ACT_FOO"}},
+		{name: "unknown action", profile: &Profile{DefaultAction: ActAllow, Syscalls: []*Syscall{{Names: []string{"read"}, Action: "SCMP_ACT_FOO"}}}},
+		{name: "unknown operator", profile: &Profile{DefaultAction: ActAllow, Syscalls: []*Syscall{
+			{Names: []string{"read"}, Action: ActErrno, Args: []*Arg{{Index: 0, Op: "SCMP_CMP_FOO"}}},
+		}}},
+		{name: "invalid index", profile: &Profile{DefaultAction: ActAllow, Syscalls: []*Syscall{
+			{Names: []string{"read"}, Action: ActErrno, Args: []*Arg{{Index: 6, Op: OpEqualTo}}},
+		}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Compile(test.profile, nil); err == nil {
+				t.Errorf("Compile() expected error")
+			}
+		})
+	}
+}
+
+func TestCompileArgJumps(t *testing.T) {
+	profile := &Profile{DefaultAction: ActAllow, Syscalls: []*Syscall{
+		{Names: []string{"write"}, Action: ActErrno, Args: []*Arg{{Index: 2, Value: 5, Op: OpGreaterThan}, {Index: 0, Value: 2, Op: OpNotEqual}}},
+	}}
+	program, err := Compile(profile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 所有跳转都必须落在程序内
+	for i, insn := range program {
+		if insn.Code&0x07 != unix.BPF_JMP {
+			continue
+		}
+		if i+1+int(insn.Jt) >= len(program) || i+1+int(insn.Jf) >= len(program) {
+			t.Errorf("instruction %d %+v jumps out of program", i, insn)
+		}
+	}
+}
+
+func TestDefaultProfileFilter(t *testing.T) {
+	program, err := Compile(DefaultProfile(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privileged, err := Compile(DefaultProfile(), []string{"CAP_SYS_ADMIN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eperm, enosys := uint32(retErrno|unix.EPERM), uint32(retErrno|unix.ENOSYS)
+	// 创建线程时 glibc 使用的 flags
+	threadFlags := uint64(unix.CLONE_VM | unix.CLONE_FS | unix.CLONE_FILES | unix.CLONE_SIGHAND | unix.CLONE_THREAD)
+	tests := []struct {
+		name     string
+		program  Program
+		arch     uint32
+		nr       string
+		args     []uint64
+		expected uint32
+	}{
+		{name: "read", program: program, nr: "read", expected: retAllow},
+		{name: "clone thread", program: program, nr: "clone", args: []uint64{threadFlags}, expected: retAllow},
+		{name: "clone new user namespace", program: program, nr: "clone", args: []uint64{threadFlags | unix.CLONE_NEWUSER}, expected: eperm},
+		{name: "clone new net namespace", program: program, nr: "clone", args: []uint64{unix.CLONE_NEWNET}, expected: eperm},
+		{name: "clone new namespace with CAP_SYS_ADMIN", program: privileged, nr: "clone", args: []uint64{unix.CLONE_NEWNS}, expected: retAllow},
+		{name: "clone3", program: program, nr: "clone3", expected: enosys},
+		{name: "unshare", program: program, nr: "unshare", args: []uint64{unix.CLONE_NEWUSER}, expected: eperm},
+		{name: "unshare with CAP_SYS_ADMIN", program: privileged, nr: "unshare", args: []uint64{unix.CLONE_NEWUSER}, expected: retAllow},
+		{name: "other arch", program: program, arch: nativeArch + 1, nr: "read", expected: eperm},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			arch := test.arch
+			if arch == 0 {
+				arch = nativeArch
+			}
+			if got := run(t, test.program, arch, syscallTable[test.nr], test.args...); got != test.expected {
+				t.Errorf("got %#x, expected %#x", got, test.expected)
+			}
+		})
+	}
+	if x32SyscallBit != 0 {
+		if got := run(t, program, nativeArch, syscallTable["read"]|x32SyscallBit); got != eperm {
+			t.Errorf("x32 syscall got %#x, expected %#x", got, eperm)
+		}
+	}
+}
+
+func TestCompileArgFilter(t *testing.T) {
+	// 参数的高 32 位和低 32 位分别比较
+	big := uint64(1) << 32
+	tests := []struct {
+		arg     *Arg
+		matched []uint64
+		missed  []uint64
+	}{
+		{arg: &Arg{Value: big + 5, Op: OpEqualTo}, matched: []uint64{big + 5}, missed: []uint64{5, big, big + 6}},
+		{arg: &Arg{Value: big + 5, Op: OpNotEqual}, matched: []uint64{5, big, 2*big + 5}, missed: []uint64{big + 5}},
+		{arg: &Arg{Value: big + 5, Op: OpGreaterThan}, matched: []uint64{big + 6, 2 * big}, missed: []uint64{big + 5, big, 6}},
+		{arg: &Arg{Value: big + 5, Op: OpGreaterEqual}, matched: []uint64{big + 5, 2 * big}, missed: []uint64{big + 4, 6}},
+		{arg: &Arg{Value: big + 5, Op: OpLessThan}, matched: []uint64{big + 4, 6}, missed: []uint64{big + 5, 2 * big}},
+		{arg: &Arg{Value: big + 5, Op: OpLessEqual}, matched: []uint64{big + 5, 6}, missed: []uint64{big + 6, 2 * big}},
+		{arg: &Arg{Value: big | 0xf0, ValueTwo: 0x30, Op: OpMaskedEqual}, matched: []uint64{0x30, 0x3f}, missed: []uint64{0x10, big | 0x30}},
+	}
+	for _, test := range tests {
+		t.Run(string(test.arg.Op), func(t *testing.T) {
+			// 比较第二个参数，确认偏移正确
+			test.arg.Index = 1
+			profile := &Profile{DefaultAction: ActAllow, Syscalls: []*Syscall{
+				{Names: []string{"write"}, Action: ActErrno, Args: []*Arg{test.arg}},
+				{Names: []string{"read"}, Action: ActErrno},
+			}}
+			program, err := Compile(profile, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			eperm := uint32(retErrno | unix.EPERM)
+			for _, value := range test.matched {
+				if got := run(t, program, nativeArch, syscallTable["write"], 0, value); got != eperm {
+					t.Errorf("arg %#x got %#x, expected errno", value, got)
+				}
+			}
+			for _, value := range test.missed {
+				if got := run(t, program, nativeArch, syscallTable["write"], 0, value); got != retAllow {
+					t.Errorf("arg %#x got %#x, expected allow", value, got)
+				}
+			}
+			// 参数不满足时继续匹配后面的规则
+			if got := run(t, program, nativeArch, syscallTable["read"], 0, test.missed[0]); got != eperm {
+				t.Errorf("read got %#x, expected errno", got)
+			}
+		})
+	}
+}
+
+func TestProgramHex(t *testing.T) {
+	program := Program{jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, 0x01020304, 1, 2), ret(retAllow)}
+	// struct sock_filter: code(u16)、jt(u8)、jf(u8)、k(u32)，小端序
+	expected := "15000102" + "04030201" + "06000000" + "0000ff7f"
+	if got := program.Hex(); got != expected {
+		t.Errorf("Hex() = %s, expected %s", got, expected)
+	}
+}
@@ -0,0 +1,69 @@
+package seccomp
+
+// cloneNewNamespaces clone 的 flags 中创建 namespace 的标志位
+// CLONE_NEWNS | CLONE_NEWCGROUP | CLONE_NEWUTS | CLONE_NEWIPC | CLONE_NEWUSER | CLONE_NEWPID | CLONE_NEWNET
+const cloneNewNamespaces = 0x7E020000
+
+// DefaultProfile 容器默认的 seccomp profile，默认允许所有系统调用，只拒绝可以影响宿主机或者逃逸容器的系统调用
+// 与 docker 默认 profile 的白名单(defaultAction 为 SCMP_ACT_ERRNO)不同，这里是黑名单，拒绝的系统调用参考了 docker 的规则
+// 部分系统调用在容器拥有对应的 capability 时(e.g. --cap-add SYS_ADMIN)才允许
+func DefaultProfile() *Profile {
+	enosys := uint(38)
+	return &Profile{
+		DefaultAction: ActAllow,
+		Syscalls: []*Syscall{
+			{
+				Names: []string{
+					"acct", "add_key", "bpf", "clock_adjtime", "clock_settime", "create_module", "get_kernel_syms",
+					"get_mempolicy", "ioperm", "iopl", "kcmp",
+					"kexec_file_load", "kexec_load", "keyctl", "lookup_dcookie", "mbind", "move_pages",
+					"name_to_handle_at", "nfsservctl", "open_by_handle_at", "perf_event_open", "query_module",
+					"request_key", "set_mempolicy", "settimeofday", "stime", "swapoff", "swapon", "sysfs", "_sysctl",
+					"uselib", "userfaultfd", "ustat", "vm86", "vm86old",
+				},
+				Action: ActErrno,
+				// 这些系统调用在容器拥有 CAP_SYS_ADMIN 时仍然允许，与 --privileged 的行为接近
+				Excludes: &Filter{Caps: []string{"CAP_SYS_ADMIN"}},
+			},
+			{
+				Names:    []string{"mount", "umount", "umount2", "pivot_root", "setns", "unshare", "fsconfig", "fsmount", "fsopen", "fspick", "move_mount", "open_tree"},
+				Action:   ActErrno,
+				Excludes: &Filter{Caps: []string{"CAP_SYS_ADMIN"}},
+			},
+			{
+				// 没有 CAP_SYS_ADMIN 时 clone 不能创建新的 namespace，flags 中不包含 CLONE_NEW* 时允许，否则拒绝
+				Names:    []string{"clone"},
+				Action:   ActAllow,
+				Args:     []*Arg{{Index: 0, Value: cloneNewNamespaces, ValueTwo: 0, Op: OpMaskedEqual}},
+				Excludes: &Filter{Caps: []string{"CAP_SYS_ADMIN"}},
+			},
+			{
+				Names:    []string{"clone"},
+				Action:   ActErrno,
+				Excludes: &Filter{Caps: []string{"CAP_SYS_ADMIN"}},
+			},
+			{
+				// clone3 的参数在结构体中无法过滤，返回 ENOSYS 让 glibc 退回使用上面过滤了 flags 的 clone
+				Names:    []string{"clone3"},
+				Action:   ActErrno,
+				ErrnoRet: &enosys,
+				Excludes: &Filter{Caps: []string{"CAP_SYS_ADMIN"}},
+			},
+			{
+				Names:    []string{"ptrace", "process_vm_readv", "process_vm_writev"},
+				Action:   ActErrno,
+				Excludes: &Filter{Caps: []string{"CAP_SYS_PTRACE"}},
+			},
+			{
+				Names:    []string{"reboot"},
+				Action:   ActErrno,
+				Excludes: &Filter{Caps: []string{"CAP_SYS_BOOT"}},
+			},
+			{
+				Names:    []string{"delete_module", "init_module", "finit_module"},
+				Action:   ActErrno,
+				Excludes: &Filter{Caps: []string{"CAP_SYS_MODULE"}},
+			},
+		},
+	}
+}
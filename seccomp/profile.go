@@ -0,0 +1,80 @@
+package seccomp
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// Action 系统调用匹配规则后的动作，与 docker seccomp profile 中的写法一致
+type Action string
+
+const (
+	ActKill        Action = "SCMP_ACT_KILL"
+	ActKillProcess Action = "SCMP_ACT_KILL_PROCESS"
+	ActKillThread  Action = "SCMP_ACT_KILL_THREAD"
+	ActTrap        Action = "SCMP_ACT_TRAP"
+	ActErrno       Action = "SCMP_ACT_ERRNO"
+	ActTrace       Action = "SCMP_ACT_TRACE"
+	ActLog         Action = "SCMP_ACT_LOG"
+	ActAllow       Action = "SCMP_ACT_ALLOW"
+)
+
+// Operator 系统调用参数的比较方式
+type Operator string
+
+const (
+	OpEqualTo      Operator = "SCMP_CMP_EQ"
+	OpNotEqual     Operator = "SCMP_CMP_NE"
+	OpLessThan     Operator = "SCMP_CMP_LT"
+	OpLessEqual    Operator = "SCMP_CMP_LE"
+	OpGreaterThan  Operator = "SCMP_CMP_GT"
+	OpGreaterEqual Operator = "SCMP_CMP_GE"
+	OpMaskedEqual  Operator = "SCMP_CMP_MASKED_EQ" // (arg & Value) == ValueTwo
+)
+
+// Profile docker 格式的 seccomp profile
+type Profile struct {
+	DefaultAction   Action     `json:"defaultAction"`
+	DefaultErrnoRet *uint      `json:"defaultErrnoRet,omitempty"`
+	Architectures   []string   `json:"architectures,omitempty"`
+	Syscalls        []*Syscall `json:"syscalls"`
+}
+
+// Syscall 一条过滤规则，Names 中的系统调用满足所有 Args 时执行 Action
+type Syscall struct {
+	Names    []string `json:"names,omitempty"`
+	Name     string   `json:"name,omitempty"` // 旧版本 profile 中每条规则只有一个系统调用
+	Action   Action   `json:"action"`
+	ErrnoRet *uint    `json:"errnoRet,omitempty"`
+	Args     []*Arg   `json:"args,omitempty"`
+	Includes *Filter  `json:"includes,omitempty"`
+	Excludes *Filter  `json:"excludes,omitempty"`
+}
+
+// Arg 系统调用参数的比较条件
+type Arg struct {
+	Index    uint     `json:"index"`
+	Value    uint64   `json:"value"`
+	ValueTwo uint64   `json:"valueTwo"`
+	Op       Operator `json:"op"`
+}
+
+// Filter 规则生效的条件，Includes 中的条件都满足时规则才生效，Excludes 中任意条件满足时规则不生效
+type Filter struct {
+	Caps   []string `json:"caps,omitempty"`
+	Arches []string `json:"arches,omitempty"`
+}
+
+// LoadProfile 读取 docker 格式的 JSON profile
+func LoadProfile(path string) (*Profile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read seccomp profile")
+	}
+	profile := new(Profile)
+	if err = json.Unmarshal(content, profile); err != nil {
+		return nil, errors.Wrapf(err, "parse seccomp profile %s", path)
+	}
+	return profile, nil
+}
@@ -0,0 +1,37 @@
+package seccomp
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"runtime"
+	"unsafe"
+)
+
+// seccomp(2) 的参数
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+)
+
+// Install 为当前进程安装 seccomp 过滤程序，之后 execve 的程序继承该过滤程序且无法删除
+// 没有 CAP_SYS_ADMIN 时必须先设置 no_new_privs，设置后 execve 的 setuid 程序也无法获得新的权限
+func Install(program Program) error {
+	if len(program) == 0 {
+		return nil
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return errors.Wrap(err, "set no_new_privs")
+	}
+	fprog := &unix.SockFprog{Len: uint16(len(program)), Filter: &program[0]}
+	// TSYNC 将过滤程序同步到进程的所有线程，Go 程序中其他线程没有过滤程序时可以绕过限制
+	r1, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(fprog)))
+	runtime.KeepAlive(program)
+	if errno != 0 {
+		return errors.Wrap(errno, "install seccomp filter")
+	}
+	// 某个线程无法同步时返回该线程的 id
+	if r1 != 0 {
+		return errors.Errorf("install seccomp filter: sync thread %d failed", r1)
+	}
+	return nil
+}
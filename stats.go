@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"os"
+	"runQ/cgroups"
+	"runQ/constant"
+	"runQ/container"
+	"runQ/network"
+	"runQ/utils"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+const statsInterval = time.Second
+
+var statsCommand = cli.Command{
+	Name:  "stats",
+	Usage: "display a live stream of container resource usage, e.g. runQ stats 1234567890",
+	Flags: []cli.Flag{
+		cli.BoolFlag{Name: "no-stream", Usage: "disable streaming stats and only pull the first result"},
+		cli.StringFlag{Name: "format", Usage: "output format, table or json"},
+	},
+	Action: func(ctx *cli.Context) error {
+		format := ctx.String("format")
+		if format != "" && format != "table" && format != "json" {
+			return fmt.Errorf("unsupported format %s, must be table or json", format)
+		}
+		return showStats(ctx.Args(), ctx.Bool("no-stream"), format == "json")
+	},
+}
+
+// containerStats 一次采样得到的容器资源使用情况
+type containerStats struct {
+	Id            string                    `json:"id"`
+	Name          string                    `json:"name"`
+	CpuPercent    float64                   `json:"cpu_percent"`
+	MemoryUsage   uint64                    `json:"memory_usage"`
+	MemoryLimit   uint64                    `json:"memory_limit"`
+	MemoryPercent float64                   `json:"memory_percent"`
+	Pids          uint64                    `json:"pids"`
+	BlockRead     uint64                    `json:"block_read"`
+	BlockWrite    uint64                    `json:"block_write"`
+	Networks      []*network.InterfaceStats `json:"networks"`
+
+	cpuUsage uint64
+	readTime time.Time
+}
+
+// showStats 类似 top 每隔一秒刷新一次，CPU 使用率需要根据两次采样之间的差值计算
+func showStats(names []string, noStream, jsonFormat bool) error {
+	previous := map[string]*containerStats{}
+	for {
+		current, err := sampleStats(names, previous)
+		if err != nil {
+			return err
+		}
+		// 第一次采样时没有可以对比的数据，--no-stream 时等待一个周期后再采样一次
+		if noStream {
+			time.Sleep(statsInterval)
+			if current, err = sampleStats(names, previous); err != nil {
+				return err
+			}
+			return printStats(current, jsonFormat, false)
+		}
+		if err = printStats(current, jsonFormat, true); err != nil {
+			return err
+		}
+		time.Sleep(statsInterval)
+	}
+}
+
+// sampleStats 对所有目标容器采样一次，并根据上一次的采样结果计算 CPU 使用率
+func sampleStats(names []string, previous map[string]*containerStats) ([]*containerStats, error) {
+	infos, err := statsTargets(names)
+	if err != nil {
+		return nil, err
+	}
+	current := make([]*containerStats, 0, len(infos))
+	for _, info := range infos {
+		stats, err := collectStats(info)
+		if err != nil {
+			log.Warnf("get container %s stats error %v", info.Id, err)
+			continue
+		}
+		if prev, ok := previous[info.Id]; ok {
+			stats.CpuPercent = cpuPercent(prev, stats)
+		}
+		previous[info.Id] = stats
+		current = append(current, stats)
+	}
+	return current, nil
+}
+
+// statsTargets 没有指定容器名时统计所有运行中的容器
+func statsTargets(names []string) ([]*container.ContainerInfo, error) {
+	if len(names) == 0 {
+		var infos []*container.ContainerInfo
+		for _, info := range container.ListContainers() {
+			if info.Status == constant.RUNNING || info.Status == constant.PAUSED {
+				infos = append(infos, info)
+			}
+		}
+		return infos, nil
+	}
+	infos := make([]*container.ContainerInfo, 0, len(names))
+	for _, name := range names {
+		info, err := container.GetContainerInfoByName(name)
+		if err != nil {
+			return nil, err
+		}
+		if info.Status != constant.RUNNING && info.Status != constant.PAUSED {
+			return nil, fmt.Errorf("container %s is not running", name)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func collectStats(info *container.ContainerInfo) (*containerStats, error) {
+	stats := &containerStats{Id: info.Id, Name: info.Name, readTime: time.Now()}
+	if info.CgroupPath != "" {
+		cgroupStats, err := cgroups.NewCgroupManager(info.CgroupPath).GetStats()
+		if err != nil {
+			return nil, err
+		}
+		stats.cpuUsage = cgroupStats.Cpu.UsageTotal
+		stats.MemoryUsage = cgroupStats.Memory.Usage
+		stats.MemoryLimit = cgroupStats.Memory.Limit
+		stats.Pids = cgroupStats.Pids.Current
+		stats.BlockRead = cgroupStats.Blkio.ReadBytes
+		stats.BlockWrite = cgroupStats.Blkio.WriteBytes
+	}
+	// 没有内存限制时使用宿主机的内存总量计算百分比
+	if stats.MemoryLimit == 0 {
+		var sysinfo syscall.Sysinfo_t
+		if err := syscall.Sysinfo(&sysinfo); err == nil {
+			stats.MemoryLimit = sysinfo.Totalram * uint64(sysinfo.Unit)
+		}
+	}
+	if stats.MemoryLimit != 0 {
+		stats.MemoryPercent = float64(stats.MemoryUsage) / float64(stats.MemoryLimit) * 100
+	}
+	networks, err := network.GetInterfaceStats(info.Pid)
+	if err != nil {
+		return nil, err
+	}
+	stats.Networks = networks
+	return stats, nil
+}
+
+// cpuPercent 两次采样之间容器使用的 CPU 时间占经过时间的百分比，使用 2 个 CPU 时为 200%
+func cpuPercent(prev, current *containerStats) float64 {
+	elapsed := current.readTime.Sub(prev.readTime).Nanoseconds()
+	if elapsed <= 0 || current.cpuUsage < prev.cpuUsage {
+		return 0
+	}
+	return float64(current.cpuUsage-prev.cpuUsage) / float64(elapsed) * 100
+}
+
+func printStats(stats []*containerStats, jsonFormat, clear bool) error {
+	if jsonFormat {
+		content, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(content))
+		return nil
+	}
+	if clear {
+		// 清屏并将光标移动到左上角，实现类似 top 的刷新效果
+		fmt.Print("\033[2J\033[H")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	_, _ = fmt.Fprint(w, "ID\tNAME\tCPU %\tMEM USAGE / LIMIT\tMEM %\tNET I/O\tBLOCK I/O\tPIDS\n")
+	for _, item := range stats {
+		var rx, tx uint64
+		for _, iface := range item.Networks {
+			rx += iface.RxBytes
+			tx += iface.TxBytes
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%.2f%%\t%s / %s\t%.2f%%\t%s / %s\t%s / %s\t%d\n",
+			item.Id,
+			item.Name,
+			item.CpuPercent,
+			utils.BytesSize(float64(item.MemoryUsage)), utils.BytesSize(float64(item.MemoryLimit)),
+			item.MemoryPercent,
+			utils.BytesSize(float64(rx)), utils.BytesSize(float64(tx)),
+			utils.BytesSize(float64(item.BlockRead)), utils.BytesSize(float64(item.BlockWrite)),
+			item.Pids)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"runQ/cgroups"
+	"runQ/cgroups/resource"
+	"runQ/constant"
+	"runQ/container"
+)
+
+var updateCommand = cli.Command{
+	Name:  "update",
+	Usage: "update resource limits of a running container, e.g. runQ update --mem 512m --cpus 2 1234567890",
+	Flags: resourceFlags,
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("missing container name")
+		}
+		return UpdateContainer(ctx, ctx.Args().Get(0))
+	},
+}
+
+// UpdateContainer 将命令行中指定的资源限制合并到容器原有的限制中，重新写入容器的 cgroup 并保存到 config.json
+func UpdateContainer(ctx *cli.Context, containerName string) error {
+	containerInfo, err := container.GetContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+	if containerInfo.Status != constant.RUNNING && containerInfo.Status != constant.PAUSED {
+		return fmt.Errorf("container %s is not running", containerName)
+	}
+	if containerInfo.CgroupPath == "" {
+		return fmt.Errorf("container %s has no cgroup", containerName)
+	}
+	update, err := buildResourceConfig(ctx)
+	if err != nil {
+		return err
+	}
+	old := containerInfo.Resource
+	if old == nil {
+		old = &resource.ResourceConfig{}
+	}
+	res := mergeResourceConfig(ctx, old, update)
+	// 特权容器可以访问所有设备，--device-cgroup-rule 不能替换掉它的 AllowAllDevices
+	if containerInfo.Privileged && ctx.IsSet("device-cgroup-rule") {
+		log.Warnf("Container %s is privileged, device cgroup rules are ignored", containerName)
+		res.Devices = []*resource.DeviceRule{resource.AllowAllDevices}
+	}
+	if err = res.Validate(); err != nil {
+		return err
+	}
+	// v1 中重新写入设备规则时需要先 deny 所有设备，容器会短暂无法访问设备，没有指定 --device-cgroup-rule 时不重新写入
+	apply, rollback := *res, *old
+	if !ctx.IsSet("device-cgroup-rule") {
+		apply.Devices, rollback.Devices = nil, nil
+	}
+	cgroupManager := cgroups.NewCgroupManager(containerInfo.CgroupPath)
+	if err = cgroupManager.Update(&apply); err != nil {
+		// 部分 subsystem 可能已经写入成功，尽量恢复为原来的限制
+		if rollbackErr := cgroupManager.Set(&rollback); rollbackErr != nil {
+			log.Warnf("rollback resource of container %s error %v", containerInfo.Id, rollbackErr)
+		}
+		return fmt.Errorf("update container %s error: %v", containerName, err)
+	}
+	containerInfo.Resource = res
+	return container.UpdateContainerInfo(containerInfo)
+}
+
+// mergeResourceConfig 只有命令行中显式指定的参数才会覆盖容器原有的限制
+func mergeResourceConfig(ctx *cli.Context, old, update *resource.ResourceConfig) *resource.ResourceConfig {
+	res := *old
+	merges := []struct {
+		flags []string
+		merge func()
+	}{
+		{[]string{"mem"}, func() { res.Memory = update.Memory }},
+		{[]string{"memory-swap"}, func() { res.MemorySwap = update.MemorySwap }},
+		{[]string{"memory-reservation"}, func() { res.MemoryReservation = update.MemoryReservation }},
+		{[]string{"memory-swappiness"}, func() { res.MemorySwappiness = update.MemorySwappiness }},
+		{[]string{"oom-kill-disable"}, func() { res.OomKillDisable = update.OomKillDisable }},
+		{[]string{"kernel-memory"}, func() { res.KernelMemory = update.KernelMemory }},
+		{[]string{"kernel-memory-tcp"}, func() { res.KernelMemoryTCP = update.KernelMemoryTCP }},
+		{[]string{"cpu", "cpus"}, func() { res.CpuPeriod, res.CpuQuota = update.CpuPeriod, update.CpuQuota }},
+		{[]string{"cpu-shares"}, func() { res.CpuShares = update.CpuShares }},
+		{[]string{"cpu-period"}, func() { res.CpuPeriod = update.CpuPeriod }},
+		{[]string{"cpu-quota"}, func() { res.CpuQuota = update.CpuQuota }},
+		{[]string{"cpuset"}, func() { res.CpuSet = update.CpuSet }},
+		{[]string{"cpuset-mems"}, func() { res.CpusetMems = update.CpusetMems }},
+		{[]string{"pids-limit"}, func() { res.PidsLimit = update.PidsLimit }},
+		{[]string{"blkio-weight"}, func() { res.BlkioWeight = update.BlkioWeight }},
+		{[]string{"blkio-weight-device"}, func() { res.BlkioWeightDevice = update.BlkioWeightDevice }},
+		{[]string{"device-read-bps"}, func() { res.BlkioThrottleReadBpsDevice = update.BlkioThrottleReadBpsDevice }},
+		{[]string{"device-write-bps"}, func() { res.BlkioThrottleWriteBpsDevice = update.BlkioThrottleWriteBpsDevice }},
+		{[]string{"device-read-iops"}, func() { res.BlkioThrottleReadIOPSDevice = update.BlkioThrottleReadIOPSDevice }},
+		{[]string{"device-write-iops"}, func() { res.BlkioThrottleWriteIOPSDevice = update.BlkioThrottleWriteIOPSDevice }},
+		{[]string{"device-cgroup-rule"}, func() { res.Devices = update.Devices }},
+		{[]string{"hugepages"}, func() { res.HugetlbLimit = update.HugetlbLimit }},
+	}
+	for _, m := range merges {
+		for _, flag := range m.flags {
+			if ctx.IsSet(flag) {
+				m.merge()
+				break
+			}
+		}
+	}
+	return &res
+}
@@ -1,37 +1,43 @@
 package utils
 
-import "fmt"
-
-const (
-	ImagePath       = "/var/lib/runQ/image/"
-	RootPath        = "/var/lib/runQ/overlay2/"
-	lowerDirFormat  = RootPath + "%s/lower"
-	upperDirFormat  = RootPath + "%s/upper"
-	workDirFormat   = RootPath + "%s/work"
-	mergedDirFormat = RootPath + "%s/merged"
-	overlayFSFormat = "lowerdir=%s,upperdir=%s,workdir=%s"
+import (
+	"fmt"
+	"path"
+	"runQ/constant"
 )
 
+const overlayFSFormat = "lowerdir=%s,upperdir=%s,workdir=%s"
+
+// ImagePath 镜像 tar 包所在的目录，跟随 constant.StateRoot
+func ImagePath() string {
+	return path.Join(constant.StateRoot, "image") + "/"
+}
+
+// RootPath 各个容器 overlay 目录的父目录，跟随 constant.StateRoot
+func RootPath() string {
+	return path.Join(constant.StateRoot, "overlay2") + "/"
+}
+
 func GetRoot(containerId string) string {
-	return RootPath + containerId
+	return RootPath() + containerId
 }
 
 func GetImage(imageName string) string {
-	return fmt.Sprintf("%s%s.tar", ImagePath, imageName)
+	return fmt.Sprintf("%s%s.tar", ImagePath(), imageName)
 }
 
 func GetLower(containerId string) string {
-	return fmt.Sprintf(lowerDirFormat, containerId)
+	return path.Join(GetRoot(containerId), "lower")
 }
 
 func GetUpper(containerId string) string {
-	return fmt.Sprintf(upperDirFormat, containerId)
+	return path.Join(GetRoot(containerId), "upper")
 }
 func GetWorker(containerId string) string {
-	return fmt.Sprintf(workDirFormat, containerId)
+	return path.Join(GetRoot(containerId), "work")
 }
 func GetMerged(containerId string) string {
-	return fmt.Sprintf(mergedDirFormat, containerId)
+	return path.Join(GetRoot(containerId), "merged")
 }
 
 func GetOverlayFsDirs(lower, upper, worker string) string {
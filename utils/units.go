@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	KiB = 1024
+	MiB = 1024 * KiB
+	GiB = 1024 * MiB
+	TiB = 1024 * GiB
+	PiB = 1024 * TiB
+)
+
+// sizeRegex 匹配 10m、10mb、1.5g、512KiB 这样的大小字符串
+var sizeRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?) ?([kKmMgGtTpP])?[iI]?[bB]?$`)
+
+var binaryMap = map[string]int64{"k": KiB, "m": MiB, "g": GiB, "t": TiB, "p": PiB}
+
+// RAMInBytes 将人类可读的大小字符串转换为字节数，单位按 1024 进制计算，e.g. 10mb -> 10485760
+func RAMInBytes(size string) (int64, error) {
+	matches := sizeRegex.FindStringSubmatch(strings.TrimSpace(size))
+	if len(matches) != 3 {
+		return -1, fmt.Errorf("invalid size: %q", size)
+	}
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return -1, fmt.Errorf("invalid size: %q", size)
+	}
+	if unit, ok := binaryMap[strings.ToLower(matches[2])]; ok {
+		value *= float64(unit)
+	}
+	// float64(math.MaxInt64) 等于 2^63，大于等于它的值转换为 int64 时会溢出
+	if value >= math.MaxInt64 {
+		return -1, fmt.Errorf("invalid size: %q", size)
+	}
+	return int64(value), nil
+}
+
+var binaryAbbrs = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+
+// BytesSize 将字节数转换为人类可读的字符串，e.g. 10485760 -> 10MiB
+func BytesSize(size float64) string {
+	i := 0
+	for size >= 1024 && i < len(binaryAbbrs)-1 {
+		size /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.4g%s", size, binaryAbbrs[i])
+}
@@ -0,0 +1,29 @@
+package utils
+
+import "testing"
+
+func TestRAMInBytes(t *testing.T) {
+	cases := map[string]int64{
+		"100":    100,
+		"10k":    10 * KiB,
+		"10mb":   10 * MiB,
+		"10MiB":  10 * MiB,
+		"1.5g":   1536 * MiB,
+		"2 GB":   2 * GiB,
+		"512KiB": 512 * KiB,
+	}
+	for size, expected := range cases {
+		got, err := RAMInBytes(size)
+		if err != nil {
+			t.Fatalf("parse %s error %v", size, err)
+		}
+		if got != expected {
+			t.Errorf("parse %s got %d, expected %d", size, got, expected)
+		}
+	}
+	for _, size := range []string{"", "abc", "10x", "-1m", "1..5m", "100000p", "9223372036854775808"} {
+		if _, err := RAMInBytes(size); err == nil {
+			t.Errorf("parse %q should fail", size)
+		}
+	}
+}